@@ -0,0 +1,99 @@
+package makerbot
+
+import "sort"
+
+// MakerBotAccount is a MakerBot account that is authorized to
+// access a printer
+type MakerBotAccount struct {
+	Username string `json:"username"`
+}
+
+// GetMakerBotAccounts lists the MakerBot accounts that are authorized
+// to access the printer
+func (c *Client) GetMakerBotAccounts() ([]MakerBotAccount, error) {
+	var reply []MakerBotAccount
+	err := c.call("get_makerbot_accounts", rpcEmptyParams{}, &reply)
+	return reply, err
+}
+
+type rpcRemoveMakerBotAccountParams struct {
+	Username string `json:"username"`
+}
+
+// RemoveMakerBotAccount revokes a MakerBot account's access to the printer
+func (c *Client) RemoveMakerBotAccount(username string) error {
+	return c.call("remove_makerbot_account", rpcRemoveMakerBotAccountParams{username}, nil)
+}
+
+// AccountCredentials is a MakerBot account along with the token needed
+// to authorize it with AddMakerBotAccount
+type AccountCredentials struct {
+	Username string
+	Token    string
+}
+
+// AccountChanges reports what ReconcileMakerBotAccounts did
+type AccountChanges struct {
+	Added   []string // Usernames that were authorized
+	Removed []string // Usernames that had their access revoked
+}
+
+// ReconcileMakerBotAccounts adds and removes MakerBot accounts so that
+// exactly the accounts in `desired` are authorized to access the printer.
+// If a username is in `desired` more than once, the first one is used.
+//
+// If an error occurs partway, the changes made so far are returned
+// along with it.
+func (c *Client) ReconcileMakerBotAccounts(desired []AccountCredentials) (*AccountChanges, error) {
+	changes := &AccountChanges{}
+
+	current, err := c.GetMakerBotAccounts()
+	if err != nil {
+		return changes, err
+	}
+
+	have := make(map[string]bool, len(current))
+	for _, acc := range current {
+		have[acc.Username] = true
+	}
+
+	want := make(map[string]bool, len(desired))
+	for _, acc := range desired {
+		// Only the first of duplicate usernames is used
+		if want[acc.Username] {
+			continue
+		}
+
+		want[acc.Username] = true
+
+		if have[acc.Username] {
+			continue
+		}
+
+		err = c.AddMakerBotAccount(acc.Username, acc.Token)
+		if err != nil {
+			return changes, err
+		}
+
+		changes.Added = append(changes.Added, acc.Username)
+	}
+
+	var remove []string
+	for username := range have {
+		if !want[username] {
+			remove = append(remove, username)
+		}
+	}
+	sort.Strings(remove)
+
+	for _, username := range remove {
+		err = c.RemoveMakerBotAccount(username)
+		if err != nil {
+			return changes, err
+		}
+
+		changes.Removed = append(changes.Removed, username)
+	}
+
+	return changes, nil
+}
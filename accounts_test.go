@@ -0,0 +1,60 @@
+package makerbot
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestReconcileMakerBotAccounts(t *testing.T) {
+	tests := []struct {
+		name    string
+		current []string
+		desired []AccountCredentials
+		added   []string
+		removed []string
+	}{
+		{"nothing to do", []string{"alice"}, []AccountCredentials{{"alice", "a"}}, nil, nil},
+		{"add", []string{"alice"}, []AccountCredentials{{"alice", "a"}, {"bob", "b"}}, []string{"bob"}, nil},
+		{"remove", []string{"carol", "alice", "bob"}, []AccountCredentials{{"alice", "a"}}, nil, []string{"bob", "carol"}},
+		{"add and remove", []string{"alice"}, []AccountCredentials{{"bob", "b"}}, []string{"bob"}, []string{"alice"}},
+		{"remove everything", []string{"alice"}, nil, nil, []string{"alice"}},
+		{"duplicates", nil, []AccountCredentials{{"bob", "b"}, {"bob", "b2"}, {"alice", "a"}}, []string{"bob", "alice"}, nil},
+	}
+
+	for _, test := range tests {
+		p := newFakePrinter(t)
+
+		var accounts []MakerBotAccount
+		for _, username := range test.current {
+			accounts = append(accounts, MakerBotAccount{username})
+		}
+
+		p.handle("get_makerbot_accounts", func(fakeCall) (interface{}, error) { return accounts, nil })
+
+		c := p.connect()
+
+		changes, err := c.ReconcileMakerBotAccounts(test.desired)
+		if err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+
+		if !reflect.DeepEqual(changes.Added, test.added) || !reflect.DeepEqual(changes.Removed, test.removed) {
+			t.Errorf("%s: added %v and removed %v, wanted %v and %v", test.name, changes.Added, changes.Removed, test.added, test.removed)
+		}
+
+		var added []string
+		for _, call := range p.received("add_makerbot_account") {
+			var params rpcAddMakerBotAccountParams
+			json.Unmarshal(call.Params, &params)
+			added = append(added, params.Username)
+		}
+
+		if !reflect.DeepEqual(added, test.added) {
+			t.Errorf("%s: printer was told to add %v, wanted %v", test.name, added, test.added)
+		}
+
+		c.Close()
+		p.Close()
+	}
+}
@@ -0,0 +1,263 @@
+// Package anomaly watches a MakerBot printer's camera during a print and
+// flags signs of a failed print, like a part that came loose from the
+// build plate or a "spaghetti" mess of filament.
+//
+// It is a simple, CPU-only heuristic: it compares where the print is in
+// every frame with the previous one, and a reference region of the build
+// plate with how it looked when the print started. It needs tuning for every printer and
+// camera placement, which is what Replay is for.
+package anomaly
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"sync"
+	"time"
+
+	makerbot "github.com/tjhorner/makerbot-rpc"
+)
+
+// Region is a rectangle of the camera's picture, in fractions of its
+// width and height (0 to 1), so that it doesn't depend on resolution.
+type Region struct {
+	X0, Y0, X1, Y1 float64
+}
+
+// FullFrame is a Region that covers the whole picture
+var FullFrame = Region{0, 0, 1, 1}
+
+// Config tunes an Analyzer. Zero-valued fields use their defaults.
+type Config struct {
+	Plate              Region  // Where the print is; sustained motion here is suspicious (default none, since the toolhead and gantry move all over the picture)
+	Reference          Region  // A part of the build plate that should stay empty; any change here is suspicious (default none)
+	MotionThreshold    float64 // Mean difference (0-1) between frames above which a frame counts as moving (default 0.08)
+	ReferenceThreshold float64 // Mean difference (0-1) from the reference above which a frame counts as changed (default 0.1)
+	Threshold          float64 // Confidence (0-1) at which an Event is emitted (default 0.8)
+	Window             int     // Number of recent frames the confidence is computed over (default 10)
+	Width              int     // Frames are scaled down to this width before analysis (default 64)
+}
+
+func (c *Config) setDefaults() {
+	if c.MotionThreshold <= 0 {
+		c.MotionThreshold = 0.08
+	}
+
+	if c.ReferenceThreshold <= 0 {
+		c.ReferenceThreshold = 0.1
+	}
+
+	if c.Threshold <= 0 {
+		c.Threshold = 0.8
+	}
+
+	if c.Window <= 0 {
+		c.Window = 10
+	}
+
+	if c.Width <= 0 {
+		c.Width = 64
+	}
+}
+
+// Result is the analysis of a single frame
+type Result struct {
+	Motion     float64 // Mean difference with the previous frame within Config.Plate
+	Reference  float64 // Mean difference with the reference within Config.Reference
+	Confidence float64 // How confident the Analyzer is that the print has failed (0-1)
+}
+
+// Event is emitted when the Analyzer's confidence reaches Config.Threshold
+type Event struct {
+	Time   time.Time
+	Result Result
+	Reason string // "motion" or "reference", whichever contributed the most
+}
+
+// Analyzer looks for anomalies in a sequence of frames from the same
+// print. Use Reset between prints.
+type Analyzer struct {
+	cfg       Config
+	prev      *gray
+	reference *gray
+	moving    []bool
+	changed   []bool
+	fired     bool
+	eventCb   *func(Event)
+	mux       sync.Mutex
+}
+
+// NewAnalyzer creates an Analyzer tuned with `cfg`
+func NewAnalyzer(cfg Config) *Analyzer {
+	cfg.setDefaults()
+	return &Analyzer{cfg: cfg}
+}
+
+// HandleEvent calls `cb` when the confidence reaches Config.Threshold.
+// It is called at most once until Reset is called.
+func (a *Analyzer) HandleEvent(cb func(Event)) {
+	a.eventCb = &cb
+}
+
+// Reset forgets everything about the previous frames. The next frame
+// becomes the new reference.
+func (a *Analyzer) Reset() {
+	a.mux.Lock()
+	defer a.mux.Unlock()
+
+	a.prev = nil
+	a.reference = nil
+	a.moving = nil
+	a.changed = nil
+	a.fired = false
+}
+
+// Analyze adds `frame` to the sequence and returns its analysis
+func (a *Analyzer) Analyze(frame *makerbot.CameraFrame) (*Result, error) {
+	img, err := frame.Image()
+	if err != nil {
+		return nil, err
+	}
+
+	return a.AnalyzeImage(img), nil
+}
+
+// AnalyzeImage is like Analyze but takes an already decoded frame
+func (a *Analyzer) AnalyzeImage(img image.Image) *Result {
+	g := newGray(img, a.cfg.Width)
+
+	a.mux.Lock()
+
+	res := &Result{}
+
+	if a.reference == nil {
+		a.reference = g
+	}
+
+	if a.prev != nil && a.cfg.Plate != (Region{}) {
+		res.Motion = g.diff(a.prev, a.cfg.Plate)
+	}
+
+	if a.cfg.Reference != (Region{}) {
+		res.Reference = g.diff(a.reference, a.cfg.Reference)
+	}
+
+	a.prev = g
+	a.moving = push(a.moving, res.Motion > a.cfg.MotionThreshold, a.cfg.Window)
+	a.changed = push(a.changed, res.Reference > a.cfg.ReferenceThreshold, a.cfg.Window)
+
+	motion := fraction(a.moving, a.cfg.Window)
+	reference := fraction(a.changed, a.cfg.Window)
+	res.Confidence = math.Max(motion, reference)
+
+	var ev *Event
+	if !a.fired && res.Confidence >= a.cfg.Threshold {
+		a.fired = true
+
+		ev = &Event{Time: time.Now(), Result: *res, Reason: "motion"}
+		if reference > motion {
+			ev.Reason = "reference"
+		}
+	}
+
+	a.mux.Unlock()
+
+	if ev != nil && a.eventCb != nil {
+		(*a.eventCb)(*ev)
+	}
+
+	return res
+}
+
+func push(window []bool, v bool, size int) []bool {
+	window = append(window, v)
+	if len(window) > size {
+		window = window[len(window)-size:]
+	}
+
+	return window
+}
+
+// fraction returns the fraction of `size` values in `window` that are
+// true. A window that isn't full yet can't reach full confidence.
+func fraction(window []bool, size int) float64 {
+	n := 0
+	for _, v := range window {
+		if v {
+			n++
+		}
+	}
+
+	return float64(n) / float64(size)
+}
+
+// gray is a small grayscale copy of a frame, with values from 0 to 1
+type gray struct {
+	w, h int
+	pix  []float64
+}
+
+func newGray(img image.Image, width int) *gray {
+	b := img.Bounds()
+	if width > b.Dx() {
+		width = b.Dx()
+	}
+
+	height := b.Dy() * width / b.Dx()
+	if height < 1 {
+		height = 1
+	}
+
+	g := &gray{w: width, h: height, pix: make([]float64, width*height)}
+
+	// Average every block of source pixels into one pixel
+	for y := 0; y < height; y++ {
+		sy0, sy1 := b.Min.Y+y*b.Dy()/height, b.Min.Y+(y+1)*b.Dy()/height
+
+		for x := 0; x < width; x++ {
+			sx0, sx1 := b.Min.X+x*b.Dx()/width, b.Min.X+(x+1)*b.Dx()/width
+
+			var sum float64
+			for sy := sy0; sy < sy1; sy++ {
+				for sx := sx0; sx < sx1; sx++ {
+					sum += float64(color.GrayModel.Convert(img.At(sx, sy)).(color.Gray).Y)
+				}
+			}
+
+			g.pix[y*width+x] = sum / float64((sy1-sy0)*(sx1-sx0)) / 255
+		}
+	}
+
+	return g
+}
+
+// diff returns the mean absolute difference between `g` and `o` within `r`
+func (g *gray) diff(o *gray, r Region) float64 {
+	if g.w != o.w || g.h != o.h {
+		return 1
+	}
+
+	x0, x1 := int(r.X0*float64(g.w)), int(math.Ceil(r.X1*float64(g.w)))
+	y0, y1 := int(r.Y0*float64(g.h)), int(math.Ceil(r.Y1*float64(g.h)))
+
+	if x1 > g.w {
+		x1 = g.w
+	}
+
+	if y1 > g.h {
+		y1 = g.h
+	}
+
+	if x0 >= x1 || y0 >= y1 {
+		return 0
+	}
+
+	var sum float64
+	for y := y0; y < y1; y++ {
+		for x := x0; x < x1; x++ {
+			sum += math.Abs(g.pix[y*g.w+x] - o.pix[y*g.w+x])
+		}
+	}
+
+	return sum / float64((x1-x0)*(y1-y0))
+}
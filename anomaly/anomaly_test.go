@@ -0,0 +1,161 @@
+package anomaly_test
+
+import (
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	makerbot "github.com/tjhorner/makerbot-rpc"
+	"github.com/tjhorner/makerbot-rpc/anomaly"
+)
+
+// scene draws a build plate with a part in the middle. If `mess` is
+// true, random strands of filament are drawn all over the plate.
+func scene(rnd *rand.Rand, mess bool) image.Image {
+	img := image.NewGray(image.Rect(0, 0, 128, 96))
+
+	for y := 0; y < 96; y++ {
+		for x := 0; x < 128; x++ {
+			v := uint8(100 + rnd.Intn(4)) // sensor noise
+			if x >= 54 && x < 74 && y >= 38 && y < 58 {
+				v = 200
+			}
+
+			img.SetGray(x, y, color.Gray{v})
+		}
+	}
+
+	if mess {
+		for i := 0; i < 40; i++ {
+			x, y := rnd.Intn(118), rnd.Intn(86)
+			for j := 0; j < 10; j++ {
+				img.SetGray(x+j, y+j%3, color.Gray{255})
+				img.SetGray(x+j, y+j%3+1, color.Gray{255})
+			}
+		}
+	}
+
+	return img
+}
+
+func TestHealthyPrint(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	a := anomaly.NewAnalyzer(anomaly.Config{Reference: anomaly.Region{0, 0, 0.2, 1}})
+
+	fired := false
+	a.HandleEvent(func(anomaly.Event) { fired = true })
+
+	for i := 0; i < 30; i++ {
+		a.AnalyzeImage(scene(rnd, false))
+	}
+
+	if fired {
+		t.Error("an event was emitted for a healthy print")
+	}
+}
+
+func TestSpaghetti(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	a := anomaly.NewAnalyzer(anomaly.Config{Plate: anomaly.FullFrame, MotionThreshold: 0.02})
+
+	var events []anomaly.Event
+	a.HandleEvent(func(ev anomaly.Event) { events = append(events, ev) })
+
+	for i := 0; i < 10; i++ {
+		a.AnalyzeImage(scene(rnd, false))
+	}
+
+	for i := 0; i < 30; i++ {
+		a.AnalyzeImage(scene(rnd, true))
+	}
+
+	if len(events) != 1 {
+		t.Fatalf("wrong number of events; wanted: 1, got: %d\n", len(events))
+	}
+
+	if events[0].Reason != "motion" || events[0].Result.Confidence < 0.8 {
+		t.Errorf("event is wrong; got: %+v\n", events[0])
+	}
+}
+
+func TestMotionNeedsPlate(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	a := anomaly.NewAnalyzer(anomaly.Config{Reference: anomaly.Region{0, 0, 0.2, 1}})
+
+	fired := false
+	a.HandleEvent(func(anomaly.Event) { fired = true })
+
+	// Without a Plate, the toolhead moving around isn't suspicious
+	for i := 0; i < 30; i++ {
+		res := a.AnalyzeImage(scene(rnd, i%2 == 1))
+		if res.Motion != 0 {
+			t.Fatalf("motion was measured without a Plate: %f", res.Motion)
+		}
+	}
+
+	if fired {
+		t.Error("an event was emitted for motion without a Plate")
+	}
+}
+
+func TestAttachNeedsRegion(t *testing.T) {
+	c := makerbot.NewClient()
+
+	_, err := anomaly.Attach(&c, anomaly.Config{}, true)
+	if err == nil {
+		t.Error("Attach without a Plate or Reference wasn't refused")
+	}
+
+	_, err = anomaly.Attach(&c, anomaly.Config{Plate: anomaly.Region{0.2, 0.2, 0.8, 0.8}}, true)
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "anomaly")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 20; i++ {
+		f, err := os.Create(filepath.Join(dir, "frame_"+strconv.Itoa(100+i)+".jpg"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// The part comes loose halfway and leaves the reference region changed
+		img := scene(rnd, false).(*image.Gray)
+		if i >= 10 {
+			for y := 0; y < 96; y++ {
+				for x := 0; x < 20; x++ {
+					img.SetGray(x, y, color.Gray{230})
+				}
+			}
+		}
+
+		jpeg.Encode(f, img, &jpeg.Options{Quality: 95})
+		f.Close()
+	}
+
+	results, ev, err := anomaly.Replay(dir, anomaly.Config{Reference: anomaly.Region{0, 0, 0.15, 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(results) != 20 {
+		t.Errorf("wrong number of results; wanted: 20, got: %d\n", len(results))
+	}
+
+	if ev == nil || ev.Reason != "reference" {
+		t.Errorf("expected a reference event; got: %+v\n", ev)
+	}
+}
@@ -0,0 +1,109 @@
+package anomaly
+
+import (
+	"errors"
+	"sync"
+
+	makerbot "github.com/tjhorner/makerbot-rpc"
+)
+
+// Detector runs an Analyzer on a Client's camera while it is printing.
+// The camera stream is only requested during StepPrinting.
+type Detector struct {
+	Analyzer *Analyzer
+	c        *makerbot.Client
+	suspend  bool
+	sub      makerbot.CameraSubscription
+	procID   int
+	eventCb  *func(Event)
+	mux      sync.Mutex
+}
+
+// Attach creates a Detector that watches prints on `c`. If `suspend` is
+// true, the print is suspended (see Client.Suspend) when an Event is
+// emitted.
+//
+// `cfg` needs a Plate or a Reference region, since a false positive can
+// suspend a healthy print.
+func Attach(c *makerbot.Client, cfg Config, suspend bool) (*Detector, error) {
+	if cfg.Plate == (Region{}) && cfg.Reference == (Region{}) {
+		return nil, errors.New("anomaly: Config needs a Plate or Reference region to watch")
+	}
+
+	d := &Detector{
+		Analyzer: NewAnalyzer(cfg),
+		c:        c,
+		suspend:  suspend,
+	}
+
+	d.Analyzer.HandleEvent(d.onEvent)
+	c.HandleStateChange(d.onStateChange)
+
+	return d, nil
+}
+
+// HandleEvent calls `cb` when an anomaly is detected during a print
+func (d *Detector) HandleEvent(cb func(Event)) {
+	d.eventCb = &cb
+}
+
+// Stop stops analyzing the camera until the next print starts
+func (d *Detector) Stop() error {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	return d.stop()
+}
+
+func (d *Detector) stop() error {
+	if d.sub == nil {
+		return nil
+	}
+
+	err := d.sub.Stop()
+	d.sub = nil
+	return err
+}
+
+func (d *Detector) onStateChange(old, new *makerbot.PrinterMetadata) {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	printing := new != nil && new.CurrentProcess != nil && new.CurrentProcess.Step == makerbot.StepPrinting
+
+	if !printing {
+		d.stop()
+		return
+	}
+
+	if d.sub != nil && d.procID == new.CurrentProcess.ID {
+		return
+	}
+
+	if d.procID != new.CurrentProcess.ID {
+		// A new print gets a new reference
+		d.Analyzer.Reset()
+		d.procID = new.CurrentProcess.ID
+	}
+
+	// Frames come one at a time and in order, which the Analyzer relies
+	// on to compare every frame with the previous one
+	sub, err := d.c.HandleCameraFrame(func(frame *makerbot.CameraFrame) {
+		d.Analyzer.Analyze(frame)
+	})
+	if err != nil {
+		return
+	}
+
+	d.sub = sub
+}
+
+func (d *Detector) onEvent(ev Event) {
+	if d.suspend {
+		go d.c.Suspend()
+	}
+
+	if d.eventCb != nil {
+		(*d.eventCb)(ev)
+	}
+}
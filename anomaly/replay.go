@@ -0,0 +1,46 @@
+package anomaly
+
+import (
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Replay runs a new Analyzer tuned with `cfg` over a recorded sequence of
+// JPEG frames (e.g. from a timelapse or the DVR) in `dir`, in file name
+// order. It returns the analysis of every frame and the Event, if any.
+//
+// Use it to tune a Config offline against prints that are known to have
+// failed or succeeded.
+func Replay(dir string, cfg Config) ([]Result, *Event, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.jpg"))
+	if err != nil {
+		return nil, nil, err
+	}
+	sort.Strings(paths)
+
+	a := NewAnalyzer(cfg)
+
+	var ev *Event
+	a.HandleEvent(func(e Event) { ev = &e })
+
+	results := make([]Result, 0, len(paths))
+
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		img, err := jpeg.Decode(f)
+		f.Close()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		results = append(results, *a.AnalyzeImage(img))
+	}
+
+	return results, ev, nil
+}
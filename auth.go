@@ -5,11 +5,18 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
+	"strings"
 	"time"
 )
 
 func (c *Client) httpGet(endpoint string, qs map[string]string) (map[string]interface{}, error) {
-	req, err := http.NewRequest("GET", "http://"+c.IP+endpoint, nil)
+	u := url.URL{Scheme: "http", Host: c.IP, Path: endpoint}
+	if strings.Contains(c.IP, ":") {
+		u.Host = "[" + c.IP + "]" // IPv6
+	}
+
+	req, err := http.NewRequest("GET", u.String(), nil)
 	if err != nil {
 		return nil, err
 	}
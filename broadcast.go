@@ -0,0 +1,91 @@
+package makerbot
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"time"
+)
+
+// MakerBot printers answer this probe when it is broadcast to
+// UDP port 12307, which is how MakerBot's own tools find them
+// on networks where mDNS doesn't work.
+const (
+	broadcastPort  = 12307
+	broadcastProbe = `{"command":"broadcast"}`
+)
+
+type broadcastReply struct {
+	Printer
+	Port interface{} `json:"port"` // sometimes a number, sometimes a string
+}
+
+func parseBroadcastReply(b []byte, from *net.UDPAddr) (*Printer, error) {
+	var reply broadcastReply
+	err := json.Unmarshal(b, &reply)
+	if err != nil {
+		return nil, err
+	}
+
+	printer := reply.Printer
+
+	switch port := reply.Port.(type) {
+	case float64:
+		printer.Port = fmt.Sprintf("%d", int(port))
+	case string:
+		printer.Port = port
+	default:
+		printer.Port = "9999"
+	}
+
+	if printer.IP == "" {
+		printer.IP = from.IP.String()
+	}
+
+	return &printer, nil
+}
+
+// DiscoverPrintersBroadcast discovers printers by broadcasting
+// MakerBot's UDP probe on the LAN and returns the ones that replied
+// once `timeout` is up. DiscoverPrinters already uses this alongside
+// mDNS, so you only need it if you want broadcast discovery alone.
+func DiscoverPrintersBroadcast(timeout time.Duration) (*[]Printer, error) {
+	return discoverBroadcast(&net.UDPAddr{IP: net.IPv4bcast, Port: broadcastPort}, timeout)
+}
+
+func discoverBroadcast(addr *net.UDPAddr, timeout time.Duration) (*[]Printer, error) {
+	conn, err := net.ListenUDP("udp4", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	_, err = conn.WriteToUDP([]byte(broadcastProbe), addr)
+	if err != nil {
+		return nil, err
+	}
+
+	conn.SetReadDeadline(time.Now().Add(timeout))
+
+	var printers []Printer
+	seen := make(map[string]bool)
+	buf := make([]byte, 8192)
+
+	for {
+		n, from, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			// Deadline reached
+			break
+		}
+
+		printer, err := parseBroadcastReply(buf[:n], from)
+		if err != nil || seen[printerKey(printer)] {
+			continue
+		}
+
+		seen[printerKey(printer)] = true
+		printers = append(printers, *printer)
+	}
+
+	return &printers, nil
+}
@@ -0,0 +1,253 @@
+package camera
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image/jpeg"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+const (
+	aviMainHeaderSize   = 56
+	aviStreamHeaderSize = 56
+	aviBitmapInfoSize   = 40
+	aviIndexEntrySize   = 16
+
+	avifHasIndex   = 0x10
+	aviifKeyframe  = 0x10
+	aviHeaderListN = 4 + (8 + aviMainHeaderSize) + (8 + 4 + (8 + aviStreamHeaderSize) + (8 + aviBitmapInfoSize))
+)
+
+// WriteAVI assembles JPEG `frames` into a Motion JPEG AVI video played
+// back at `fps` frames per second, and writes it to `w`.
+//
+// All frames are expected to have the same dimensions as the first one.
+func WriteAVI(w io.Writer, frames [][]byte, fps int) error {
+	sizes := make([]uint32, len(frames))
+	for i, frame := range frames {
+		sizes[i] = uint32(len(frame))
+	}
+
+	return writeAVI(w, sizes, fps, func(i int) (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(frames[i])), nil
+	})
+}
+
+// WriteAVIFiles is like WriteAVI but reads the JPEG frames from
+// the files at `paths`.
+func WriteAVIFiles(w io.Writer, paths []string, fps int) error {
+	sizes := make([]uint32, len(paths))
+	for i, path := range paths {
+		stat, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+
+		sizes[i] = uint32(stat.Size())
+	}
+
+	return writeAVI(w, sizes, fps, func(i int) (io.ReadCloser, error) {
+		return os.Open(paths[i])
+	})
+}
+
+// CreateAVI is like WriteAVIFiles but creates the video file at `path`
+func CreateAVI(path string, frames []string, fps int) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	err = WriteAVIFiles(f, frames, fps)
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+func writeAVI(w io.Writer, sizes []uint32, fps int, open func(i int) (io.ReadCloser, error)) error {
+	if len(sizes) == 0 {
+		return errors.New("no frames to write")
+	}
+
+	if fps <= 0 {
+		fps = 24
+	}
+
+	first, err := open(0)
+	if err != nil {
+		return err
+	}
+
+	cfg, err := jpeg.DecodeConfig(first)
+	first.Close()
+	if err != nil {
+		return err
+	}
+
+	width, height := cfg.Width, cfg.Height
+
+	var maxSize uint32
+	moviSize := uint32(4)
+
+	for _, size := range sizes {
+		if size > maxSize {
+			maxSize = size
+		}
+
+		moviSize += 8 + pad(size)
+	}
+
+	n := uint32(len(sizes))
+	idxSize := n * aviIndexEntrySize
+	riffSize := 4 + (8 + aviHeaderListN) + (8 + moviSize) + (8 + idxSize)
+
+	aw := &aviWriter{w: w}
+
+	aw.fourcc("RIFF")
+	aw.u32(riffSize)
+	aw.fourcc("AVI ")
+
+	aw.fourcc("LIST")
+	aw.u32(aviHeaderListN)
+	aw.fourcc("hdrl")
+
+	aw.fourcc("avih")
+	aw.u32(aviMainHeaderSize)
+	aw.u32(uint32(1000000 / fps)) // microseconds per frame
+	aw.u32(maxSize * uint32(fps)) // max bytes per second
+	aw.u32(0)                     // padding granularity
+	aw.u32(avifHasIndex)          // flags
+	aw.u32(n)                     // total frames
+	aw.u32(0)                     // initial frames
+	aw.u32(1)                     // streams
+	aw.u32(maxSize)               // suggested buffer size
+	aw.u32(uint32(width))
+	aw.u32(uint32(height))
+	aw.u32(0) // reserved
+	aw.u32(0)
+	aw.u32(0)
+	aw.u32(0)
+
+	aw.fourcc("LIST")
+	aw.u32(4 + (8 + aviStreamHeaderSize) + (8 + aviBitmapInfoSize))
+	aw.fourcc("strl")
+
+	aw.fourcc("strh")
+	aw.u32(aviStreamHeaderSize)
+	aw.fourcc("vids")
+	aw.fourcc("MJPG")
+	aw.u32(0) // flags
+	aw.u16(0) // priority
+	aw.u16(0) // language
+	aw.u32(0) // initial frames
+	aw.u32(1) // scale
+	aw.u32(uint32(fps))
+	aw.u32(0) // start
+	aw.u32(n) // length
+	aw.u32(maxSize)
+	aw.u32(0xffffffff) // quality (default)
+	aw.u32(0)          // sample size
+	aw.u16(0)          // frame rectangle
+	aw.u16(0)
+	aw.u16(uint16(width))
+	aw.u16(uint16(height))
+
+	aw.fourcc("strf")
+	aw.u32(aviBitmapInfoSize)
+	aw.u32(aviBitmapInfoSize)
+	aw.u32(uint32(width))
+	aw.u32(uint32(height))
+	aw.u16(1)  // planes
+	aw.u16(24) // bits per pixel
+	aw.fourcc("MJPG")
+	aw.u32(uint32(width * height * 3))
+	aw.u32(0) // pixels per meter
+	aw.u32(0)
+	aw.u32(0) // colors used
+	aw.u32(0) // important colors
+
+	aw.fourcc("LIST")
+	aw.u32(moviSize)
+	aw.fourcc("movi")
+
+	for i, size := range sizes {
+		aw.fourcc("00dc")
+		aw.u32(size)
+
+		if aw.err != nil {
+			return aw.err
+		}
+
+		err = copyFrame(w, open, i, size)
+		if err != nil {
+			return err
+		}
+
+		if size%2 != 0 {
+			aw.write([]byte{0})
+		}
+	}
+
+	aw.fourcc("idx1")
+	aw.u32(idxSize)
+
+	offset := uint32(4)
+	for _, size := range sizes {
+		aw.fourcc("00dc")
+		aw.u32(aviifKeyframe)
+		aw.u32(offset)
+		aw.u32(size)
+
+		offset += 8 + pad(size)
+	}
+
+	return aw.err
+}
+
+type aviWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (aw *aviWriter) write(b []byte) {
+	if aw.err != nil {
+		return
+	}
+
+	_, aw.err = aw.w.Write(b)
+}
+
+func (aw *aviWriter) fourcc(s string) { aw.write([]byte(s)) }
+
+func (aw *aviWriter) u32(v uint32) {
+	var b [4]byte
+	binary.LittleEndian.PutUint32(b[:], v)
+	aw.write(b[:])
+}
+
+func (aw *aviWriter) u16(v uint16) {
+	var b [2]byte
+	binary.LittleEndian.PutUint16(b[:], v)
+	aw.write(b[:])
+}
+
+func pad(size uint32) uint32 {
+	return size + size%2
+}
+
+func copyFrame(w io.Writer, open func(i int) (io.ReadCloser, error), i int, size uint32) error {
+	r, err := open(i)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	_, err = io.CopyN(w, r, int64(size))
+	return err
+}
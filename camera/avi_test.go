@@ -0,0 +1,39 @@
+package camera_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/jpeg"
+	"testing"
+
+	"github.com/tjhorner/makerbot-rpc/camera"
+)
+
+func TestWriteAVI(t *testing.T) {
+	var frames [][]byte
+	for i := 0; i < 3; i++ {
+		var buf bytes.Buffer
+		jpeg.Encode(&buf, image.NewGray(image.Rect(0, 0, 16, 8)), nil)
+		frames = append(frames, buf.Bytes())
+	}
+
+	var buf bytes.Buffer
+	err := camera.WriteAVI(&buf, frames, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := buf.Bytes()
+	if string(b[0:4]) != "RIFF" || string(b[8:12]) != "AVI " {
+		t.Fatalf("not an AVI file; got header %q\n", b[0:12])
+	}
+
+	if size := binary.LittleEndian.Uint32(b[4:8]); int(size)+8 != len(b) {
+		t.Errorf("RIFF size is wrong; wanted: %d, got: %d\n", len(b)-8, size)
+	}
+
+	if !bytes.Contains(b, []byte("idx1")) || bytes.Count(b, []byte("00dc")) != 6 {
+		t.Errorf("AVI is missing frames or its index")
+	}
+}
@@ -0,0 +1,180 @@
+// Package camera serves a MakerBot printer's camera over HTTP.
+package camera
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+
+	makerbot "github.com/tjhorner/makerbot-rpc"
+)
+
+const boundary = "makerbotframe"
+
+// Source is something that produces camera frames, usually
+// a *makerbot.Client.
+type Source interface {
+	GetCameraFrame() (*makerbot.CameraFrame, error)
+	HandleCameraFrame(cb func(frame *makerbot.CameraFrame)) (makerbot.CameraSubscription, error)
+}
+
+// Server is an http.Handler that serves a printer's camera as a
+// `multipart/x-mixed-replace` MJPEG stream. Any number of viewers share
+// a single stream from the printer, which is started when the first
+// viewer connects and ended when the last one leaves.
+//
+// Snapshot can be used to serve a single JPEG frame.
+type Server struct {
+	src     Source
+	viewers map[chan []byte]struct{}
+	sub     makerbot.CameraSubscription
+	latest  []byte
+	mux     sync.Mutex
+}
+
+// NewServer creates a Server that streams frames from `src`
+func NewServer(src Source) *Server {
+	return &Server{
+		src:     src,
+		viewers: make(map[chan []byte]struct{}),
+	}
+}
+
+// Viewers returns the number of viewers currently watching the stream
+func (s *Server) Viewers() int {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	return len(s.viewers)
+}
+
+func (s *Server) onFrame(frame *makerbot.CameraFrame) {
+	// YUYV frames are converted, JPEG frames are passed through as-is
+	data, err := frame.JPEG(makerbot.FrameEncodeOptions{})
+	if err != nil {
+		return
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if s.sub == nil {
+		return
+	}
+
+	s.latest = data
+
+	for ch := range s.viewers {
+		// Drop the frame for viewers that can't keep up
+		select {
+		case ch <- data:
+		default:
+		}
+	}
+}
+
+func (s *Server) addViewer() (chan []byte, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	ch := make(chan []byte, 1)
+
+	if s.sub == nil {
+		sub, err := s.src.HandleCameraFrame(s.onFrame)
+		if err != nil {
+			return nil, err
+		}
+
+		s.sub = sub
+	}
+
+	s.viewers[ch] = struct{}{}
+	return ch, nil
+}
+
+func (s *Server) removeViewer(ch chan []byte) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	delete(s.viewers, ch)
+
+	if len(s.viewers) == 0 && s.sub != nil {
+		s.sub.Stop()
+		s.sub = nil
+		s.latest = nil
+	}
+}
+
+// ServeHTTP serves the MJPEG stream until the viewer disconnects
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ch, err := s.addViewer()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer s.removeViewer(ch)
+
+	flusher, _ := w.(http.Flusher)
+
+	w.Header().Set("Content-Type", "multipart/x-mixed-replace; boundary="+boundary)
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	if flusher != nil {
+		flusher.Flush()
+	}
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case data := <-ch:
+			_, err := fmt.Fprintf(w, "--%s\r\nContent-Type: image/jpeg\r\nContent-Length: %d\r\n\r\n", boundary, len(data))
+			if err != nil {
+				return
+			}
+
+			_, err = w.Write(data)
+			if err != nil {
+				return
+			}
+
+			_, err = w.Write([]byte("\r\n"))
+			if err != nil {
+				return
+			}
+
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+	}
+}
+
+// Snapshot serves a single JPEG frame. If the stream is running, the
+// latest frame from it is used, otherwise a new frame is requested
+// from the printer.
+func (s *Server) Snapshot(w http.ResponseWriter, r *http.Request) {
+	s.mux.Lock()
+	data := s.latest
+	s.mux.Unlock()
+
+	if data == nil {
+		frame, err := s.src.GetCameraFrame()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+
+		data, err = frame.JPEG(makerbot.FrameEncodeOptions{})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Header().Set("Content-Length", fmt.Sprintf("%d", len(data)))
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Write(data)
+}
@@ -0,0 +1,140 @@
+package camera_test
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	makerbot "github.com/tjhorner/makerbot-rpc"
+	"github.com/tjhorner/makerbot-rpc/camera"
+)
+
+type fakeSource struct {
+	cbs map[*fakeSubscription]func(*makerbot.CameraFrame)
+	mux sync.Mutex
+}
+
+type fakeSubscription struct {
+	src *fakeSource
+}
+
+func (s *fakeSubscription) Stop() error {
+	s.src.mux.Lock()
+	defer s.src.mux.Unlock()
+
+	delete(s.src.cbs, s)
+	return nil
+}
+
+func jpegFrame(data string) *makerbot.CameraFrame {
+	return &makerbot.CameraFrame{
+		Data:     []byte(data),
+		Metadata: &makerbot.CameraFrameMetadata{FileSize: uint32(len(data)), Format: makerbot.CameraFrameFormatJPEG},
+	}
+}
+
+func (f *fakeSource) GetCameraFrame() (*makerbot.CameraFrame, error) {
+	return jpegFrame("snapshot"), nil
+}
+
+func (f *fakeSource) HandleCameraFrame(cb func(*makerbot.CameraFrame)) (makerbot.CameraSubscription, error) {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+
+	if f.cbs == nil {
+		f.cbs = make(map[*fakeSubscription]func(*makerbot.CameraFrame))
+	}
+
+	sub := &fakeSubscription{f}
+	f.cbs[sub] = cb
+	return sub, nil
+}
+
+func (f *fakeSource) isStreaming() bool {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+
+	return len(f.cbs) > 0
+}
+
+func (f *fakeSource) send(frame *makerbot.CameraFrame) {
+	f.mux.Lock()
+	var cbs []func(*makerbot.CameraFrame)
+	for _, cb := range f.cbs {
+		cbs = append(cbs, cb)
+	}
+	f.mux.Unlock()
+
+	for _, cb := range cbs {
+		cb(frame)
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	srv := camera.NewServer(&fakeSource{})
+
+	rec := httptest.NewRecorder()
+	srv.Snapshot(rec, httptest.NewRequest("GET", "/snapshot.jpg", nil))
+
+	if rec.Header().Get("Content-Type") != "image/jpeg" {
+		t.Errorf("content type is wrong; wanted: image/jpeg, got: %s\n", rec.Header().Get("Content-Type"))
+	}
+
+	if rec.Body.String() != "snapshot" {
+		t.Errorf("body is wrong; wanted: snapshot, got: %s\n", rec.Body.String())
+	}
+}
+
+func TestStream(t *testing.T) {
+	src := &fakeSource{}
+	srv := camera.NewServer(src)
+
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "multipart/x-mixed-replace") {
+		t.Errorf("content type is wrong; got: %s\n", resp.Header.Get("Content-Type"))
+	}
+
+	if srv.Viewers() != 1 || !src.isStreaming() {
+		t.Fatalf("stream was not started for the first viewer")
+	}
+
+	go func() {
+		for i := 0; i < 10; i++ {
+			src.send(jpegFrame("frame"))
+			time.Sleep(10 * time.Millisecond)
+		}
+	}()
+
+	r := bufio.NewReader(resp.Body)
+	line, err := r.ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if line != "--makerbotframe\r\n" {
+		t.Errorf("boundary is wrong; got: %q\n", line)
+	}
+
+	resp.Body.Close()
+	ioutil.ReadAll(r)
+
+	for i := 0; i < 100 && srv.Viewers() != 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if srv.Viewers() != 0 || src.isStreaming() {
+		t.Errorf("stream was not ended after the last viewer left")
+	}
+}
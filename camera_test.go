@@ -0,0 +1,189 @@
+package makerbot
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+// sendFrame makes the fake printer send a 4x2 YUYV camera frame
+func sendFrame(p *fakePrinter, data []byte) {
+	raw := make([]byte, 16)
+	binary.BigEndian.PutUint32(raw[0:4], uint32(16+len(data)))
+	binary.BigEndian.PutUint32(raw[4:8], 4)
+	binary.BigEndian.PutUint32(raw[8:12], 2)
+	binary.BigEndian.PutUint32(raw[12:16], uint32(CameraFrameFormatYUYV))
+
+	p.notify("camera_frame", map[string]interface{}{})
+
+	// The client only reads raw data once it has handled the
+	// notification, and reads the header and the frame separately
+	time.Sleep(50 * time.Millisecond)
+	p.write(raw)
+	time.Sleep(50 * time.Millisecond)
+	p.write(data)
+}
+
+func TestCameraSubscriptions(t *testing.T) {
+	p := newFakePrinter(t)
+	defer p.Close()
+
+	c := p.connect()
+	defer c.Close()
+
+	a, err := c.HandleCameraFrame(func(*CameraFrame) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := c.HandleCameraFrame(func(*CameraFrame) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n := len(p.received("request_camera_stream")); n != 1 {
+		t.Errorf("stream was started %d times for 2 subscriptions, wanted once", n)
+	}
+
+	a.Stop()
+	a.Stop()
+
+	if n := len(p.received("end_camera_stream")); n != 0 {
+		t.Error("stream was ended while a subscription was left")
+	}
+
+	b.Stop()
+
+	if n := len(p.received("end_camera_stream")); n != 1 {
+		t.Errorf("stream was ended %d times, wanted once", n)
+	}
+
+	_, err = c.HandleCameraFrame(func(*CameraFrame) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n := len(p.received("request_camera_stream")); n != 2 {
+		t.Errorf("stream was started %d times, wanted it started again", n)
+	}
+}
+
+func TestCameraSubscriptionFailed(t *testing.T) {
+	p := newFakePrinter(t)
+	defer p.Close()
+
+	p.handle("request_camera_stream", func(fakeCall) (interface{}, error) { return nil, errFake })
+
+	c := p.connect()
+	defer c.Close()
+
+	_, err := c.HandleCameraFrame(func(*CameraFrame) {})
+	if err == nil {
+		t.Fatal("failing to start the stream wasn't an error")
+	}
+
+	c.cameraMux.Lock()
+	defer c.cameraMux.Unlock()
+
+	if len(c.cameraSubs) != 0 {
+		t.Error("failed subscription was kept")
+	}
+}
+
+func TestGetCameraFrameWhileStreaming(t *testing.T) {
+	p := newFakePrinter(t)
+	defer p.Close()
+
+	// The printer takes its time to start the stream; frames must still
+	// be delivered meanwhile
+	release := make(chan struct{})
+	p.handle("request_camera_stream", func(fakeCall) (interface{}, error) {
+		<-release
+		return true, nil
+	})
+
+	c := p.connect()
+	defer c.Close()
+
+	frames := make(chan *CameraFrame, 1)
+	go c.HandleCameraFrame(func(frame *CameraFrame) {
+		select {
+		case frames <- frame:
+		default:
+		}
+	})
+
+	// Wait for the subscription to be made
+	for i := 0; i < 100; i++ {
+		c.cameraMux.Lock()
+		n := len(c.cameraSubs)
+		c.cameraMux.Unlock()
+
+		if n > 0 {
+			break
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	data := []byte{16, 128, 16, 128, 235, 128, 235, 128, 16, 128, 16, 128, 235, 128, 235, 128}
+	go sendFrame(p, data)
+
+	frame, err := c.GetCameraFrame()
+	close(release)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(frame.Data, data) || frame.Metadata.Width != 4 {
+		t.Errorf("got a %dx%d frame with %v", frame.Metadata.Width, frame.Metadata.Height, frame.Data)
+	}
+
+	if len(p.received("request_camera_frame")) != 0 {
+		t.Error("a snapshot was requested even though the camera was streaming")
+	}
+
+	select {
+	case <-frames:
+	case <-time.After(time.Second):
+		t.Error("subscription didn't get the frame")
+	}
+}
+
+func TestCameraFramesInOrder(t *testing.T) {
+	p := newFakePrinter(t)
+	defer p.Close()
+
+	c := p.connect()
+	defer c.Close()
+
+	const n = 5
+
+	got := make(chan byte, n)
+	sub, err := c.HandleCameraFrame(func(frame *CameraFrame) {
+		// A slow callback mustn't get frames out of order
+		time.Sleep(30 * time.Millisecond)
+		got <- frame.Data[0]
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Stop()
+
+	for i := 0; i < n; i++ {
+		sendFrame(p, bytes.Repeat([]byte{byte(i)}, 16))
+	}
+
+	for i := 0; i < n; i++ {
+		select {
+		case b := <-got:
+			if b != byte(i) {
+				t.Fatalf("got frame %d as frame %d", b, i)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("got %d frames, wanted %d", i, n)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package makerbot
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -14,6 +15,10 @@ import (
 
 const printFileBlockSize = 50000 // 50 KB
 
+// cameraFrameBuffer is how many frames a camera subscription can fall
+// behind before frames are dropped for it
+const cameraFrameBuffer = 4
+
 type rpcEmptyParams struct{}
 
 type rpcSystemNotification struct {
@@ -26,18 +31,30 @@ type rpcSystemNotification struct {
 // Calls to the printer (e.g. LoadFilament, Cancel, etc.)
 // will block, so you may want to take this into consideration.
 type Client struct {
-	Connected bool
-	IP        string
-	Port      string
-	Printer   *Printer
-	Timeout   time.Duration
-	verbose   bool
-	stateCbs  []func(old, new *PrinterMetadata)
-	cameraCh  *chan CameraFrame
-	cameraCbs []func(*CameraFrame)
-	discCb    *func()
-	rpc       *jsonrpc.Client
-	mux       sync.Mutex // special mutex for sending print parts
+	Connected  bool
+	IP         string
+	Port       string
+	Printer    *Printer
+	Timeout    time.Duration
+	verbose    bool
+	stateCbs   []*stateCallback
+	cameraSubs map[*cameraSubscription]struct{}
+	cameraChs  []chan CameraFrame // waiting for a single frame (see GetCameraFrame)
+	discCb     *func()
+	rpc        *jsonrpc.Client
+	mux        sync.Mutex // special mutex for sending print parts
+	cameraMux  sync.Mutex // protects cameraSubs and cameraChs
+	streamMux  sync.Mutex // serializes starting and ending the camera stream, protects streaming
+	stateMux   sync.Mutex // protects stateCbs
+	connMux    sync.Mutex // protects Connected
+	streaming  bool       // whether the printer was told to stream camera frames
+
+	disconnected chan struct{} // closed once the connection is lost
+	discOnce     *sync.Once
+}
+
+type stateCallback struct {
+	cb func(old, new *PrinterMetadata)
 }
 
 // SetVerbose will enable or disable verbose logging for both
@@ -132,25 +149,28 @@ func (c *Client) ConnectRemote(id, accessToken string, useRefl ...*reflector.Cli
 }
 
 func (c *Client) connectRPC() error {
+	return c.connectRPCContext(context.Background())
+}
+
+func (c *Client) connectRPCContext(ctx context.Context) error {
 	c.rpc = jsonrpc.NewClient(c.IP, c.Port)
 	c.rpc.Verbose = c.verbose
+	c.disconnected = make(chan struct{})
+	c.discOnce = &sync.Once{}
 
-	err := c.rpc.Connect()
+	err := c.rpc.ConnectContext(ctx)
 	if err != nil {
 		return err
 	}
 
-	c.Connected = true
+	c.setConnected(true)
 
 	return nil
 }
 
 func (c *Client) handshake() error {
 	c.rpc.HandleReadError(func(err error) {
-		c.Connected = false
-		if c.discCb != nil {
-			(*c.discCb)()
-		}
+		c.disconnect()
 	})
 
 	printer, err := c.sendHandshake()
@@ -180,12 +200,8 @@ func (c *Client) handshake() error {
 			case <-resp:
 				// Do nothing
 			case <-time.After(c.Timeout):
-				c.Connected = false
 				c.Close()
-
-				if c.discCb != nil {
-					(*c.discCb)()
-				}
+				c.disconnect()
 				return
 			}
 
@@ -206,8 +222,13 @@ func (c *Client) handshake() error {
 
 		c.Printer.Metadata = newState.Info
 
-		for _, cb := range c.stateCbs {
-			go cb(oldState, newState.Info) // Async so we don't block other callbacks
+		c.stateMux.Lock()
+		cbs := make([]*stateCallback, len(c.stateCbs))
+		copy(cbs, c.stateCbs)
+		c.stateMux.Unlock()
+
+		for _, sc := range cbs {
+			go sc.cb(oldState, newState.Info) // Async so we don't block other callbacks
 		}
 	}
 
@@ -223,19 +244,42 @@ func (c *Client) handshake() error {
 			Metadata: &metadata,
 		}
 
-		if c.cameraCh != nil {
-			*c.cameraCh <- frame
-			c.cameraCh = nil
+		c.cameraMux.Lock()
+		chs := c.cameraChs
+		c.cameraChs = nil
+
+		// Every subscription gets its frames in order from its own
+		// goroutine, so slow callbacks don't block each other
+		for sub := range c.cameraSubs {
+			select {
+			case sub.frames <- &frame:
+			default:
+				// The callback is falling behind; skip this frame for it
+			}
 		}
+		c.cameraMux.Unlock()
 
-		for _, cb := range c.cameraCbs {
-			go cb(&frame) // Async so we don't block other callbacks
+		for _, ch := range chs {
+			ch <- frame // Buffered, so this won't block
 		}
 	})
 
 	return nil
 }
 
+// disconnect marks the client as disconnected and calls the disconnect
+// callback, once
+func (c *Client) disconnect() {
+	c.discOnce.Do(func() {
+		c.setConnected(false)
+		close(c.disconnected)
+
+		if c.discCb != nil {
+			(*c.discCb)()
+		}
+	})
+}
+
 // Close closes the underlying TCP socket
 // and should be called when the client is no
 // longer needed
@@ -252,18 +296,170 @@ func (c *Client) Close() error {
 // The first parameter passed to `cb` is the previous state, and the
 // second is the new state. You can use this to respond when e.g. a print
 // fails for some reason, or when a print's progress changes.
-func (c *Client) HandleStateChange(cb func(old, new *PrinterMetadata)) {
-	c.stateCbs = append(c.stateCbs, cb)
+//
+// Calling the returned function removes `cb` again.
+func (c *Client) HandleStateChange(cb func(old, new *PrinterMetadata)) (remove func()) {
+	sc := &stateCallback{cb}
+
+	c.stateMux.Lock()
+	c.stateCbs = append(c.stateCbs, sc)
+	c.stateMux.Unlock()
+
+	return func() {
+		c.stateMux.Lock()
+		defer c.stateMux.Unlock()
+
+		for i, other := range c.stateCbs {
+			if other == sc {
+				c.stateCbs = append(c.stateCbs[:i], c.stateCbs[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// HandleStepChange calls `cb` when the current process moves to a
+// different step (e.g. from StepHoming to StepPositionFound).
+//
+// `proc` is the process the step belongs to. `old` is StepUnknown if
+// there was no process before.
+func (c *Client) HandleStepChange(cb func(proc *PrinterProcess, old, new PrintProcessStep)) {
+	c.HandleStateChange(func(oldState, newState *PrinterMetadata) {
+		if newState == nil || newState.CurrentProcess == nil {
+			return
+		}
+
+		oldStep := StepUnknown
+		if oldState != nil && oldState.CurrentProcess != nil && oldState.CurrentProcess.ID == newState.CurrentProcess.ID {
+			oldStep = oldState.CurrentProcess.Step
+		}
+
+		if oldStep == newState.CurrentProcess.Step {
+			return
+		}
+
+		cb(newState.CurrentProcess, oldStep, newState.CurrentProcess.Step)
+	})
+}
+
+// CameraSubscription is returned by HandleCameraFrame and can be used
+// to stop receiving camera frames.
+type CameraSubscription interface {
+	// Stop stops calling the subscription's callback. If it was the
+	// last subscription, the printer is told to end the camera stream.
+	// It is safe to call Stop more than once.
+	Stop() error
+}
+
+type cameraSubscription struct {
+	c      *Client
+	frames chan *CameraFrame // closed when the subscription is stopped
+}
+
+func (s *cameraSubscription) run(cb func(frame *CameraFrame)) {
+	for frame := range s.frames {
+		cb(frame)
+	}
+}
+
+func (s *cameraSubscription) Stop() error {
+	c := s.c
+
+	c.cameraMux.Lock()
+	if _, ok := c.cameraSubs[s]; !ok {
+		c.cameraMux.Unlock()
+		return nil
+	}
+
+	delete(c.cameraSubs, s)
+	close(s.frames)
+	c.cameraMux.Unlock()
+
+	return c.syncCameraStream()
+}
+
+// HandleCameraFrame calls `cb` every time the printer sends a camera
+// frame, until Stop is called on the returned CameraSubscription.
+//
+// The printer's camera stream is started when the first subscription
+// is made and ended when the last one is stopped, so any number of
+// subscriptions can share a single stream.
+//
+// Frames are passed to `cb` one at a time, in the order they were
+// received. If `cb` falls behind by more than a few frames, frames are
+// skipped for it until it catches up.
+func (c *Client) HandleCameraFrame(cb func(frame *CameraFrame)) (CameraSubscription, error) {
+	sub := &cameraSubscription{c, make(chan *CameraFrame, cameraFrameBuffer)}
+	go sub.run(cb)
+
+	c.cameraMux.Lock()
+	if c.cameraSubs == nil {
+		c.cameraSubs = make(map[*cameraSubscription]struct{})
+	}
+
+	c.cameraSubs[sub] = struct{}{}
+	c.cameraMux.Unlock()
+
+	err := c.syncCameraStream()
+	if err != nil {
+		c.cameraMux.Lock()
+		delete(c.cameraSubs, sub)
+		close(sub.frames)
+		c.cameraMux.Unlock()
+
+		return nil, err
+	}
+
+	return sub, nil
+}
+
+// syncCameraStream starts or ends the printer's camera stream so that it
+// runs while there are subscriptions. cameraMux isn't held during the
+// calls, so frames keep being delivered while they are made.
+func (c *Client) syncCameraStream() error {
+	c.streamMux.Lock()
+	defer c.streamMux.Unlock()
+
+	c.cameraMux.Lock()
+	want := len(c.cameraSubs) > 0
+	c.cameraMux.Unlock()
+
+	if want == c.streaming {
+		return nil
+	}
+
+	var err error
+	switch {
+	case want:
+		err = c.startCameraStream()
+	case c.isConnected():
+		err = c.endCameraStream()
+	}
+
+	if err != nil {
+		return err
+	}
+
+	c.streaming = want
+	return nil
 }
 
-// HandleCameraFrame calls `cb` when the printer sends a camera frame.
-func (c *Client) HandleCameraFrame(cb func(frame *CameraFrame)) {
-	c.cameraCbs = append(c.cameraCbs, cb)
-	go c.requestCameraStream()
+func (c *Client) setConnected(connected bool) {
+	c.connMux.Lock()
+	defer c.connMux.Unlock()
+
+	c.Connected = connected
+}
+
+func (c *Client) isConnected() bool {
+	c.connMux.Lock()
+	defer c.connMux.Unlock()
+
+	return c.Connected
 }
 
 func (c *Client) call(method string, args, result interface{}) error {
-	if !c.Connected {
+	if !c.isConnected() {
 		return errors.New("client is not connected to printer")
 	}
 
@@ -125,7 +125,7 @@ func (c *Client) requestCameraFrame() (*bool, error) {
 	return &reply, c.call("request_camera_frame", rpcEmptyParams{}, &reply)
 }
 
-func (c *Client) requestCameraStream() error {
+func (c *Client) startCameraStream() error {
 	return c.call("request_camera_stream", rpcEmptyParams{}, nil)
 }
 
@@ -133,24 +133,55 @@ func (c *Client) endCameraStream() error {
 	return c.call("end_camera_stream", rpcEmptyParams{}, nil)
 }
 
-// GetCameraFrame requests a single frame from the printer's camera
-func (c *Client) GetCameraFrame() (*CameraFrame, error) {
-	ch := make(chan CameraFrame)
-	c.cameraCh = &ch
+func (c *Client) stopWaitingForFrame(ch chan CameraFrame) {
+	c.cameraMux.Lock()
+	defer c.cameraMux.Unlock()
 
-	res, err := c.requestCameraFrame()
-	if err != nil {
-		return nil, err
+	for i, w := range c.cameraChs {
+		if w == ch {
+			c.cameraChs = append(c.cameraChs[:i], c.cameraChs[i+1:]...)
+			break
+		}
 	}
+}
+
+// GetCameraFrame requests a single frame from the printer's camera.
+//
+// If the camera is already streaming because of HandleCameraFrame,
+// the next frame from the stream is returned instead.
+func (c *Client) GetCameraFrame() (*CameraFrame, error) {
+	ch := make(chan CameraFrame, 1)
 
-	if !*res {
-		return nil, errors.New("printer is not giving frame")
+	c.cameraMux.Lock()
+	c.cameraChs = append(c.cameraChs, ch)
+	streaming := len(c.cameraSubs) > 0
+	c.cameraMux.Unlock()
+
+	if !streaming {
+		res, err := c.requestCameraFrame()
+		if err != nil {
+			c.stopWaitingForFrame(ch)
+			return nil, err
+		}
+
+		if !*res {
+			c.stopWaitingForFrame(ch)
+			return nil, errors.New("printer is not giving frame")
+		}
 	}
 
-	data := <-ch
-	close(ch)
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
 
-	return &data, nil
+	select {
+	case frame := <-ch:
+		return &frame, nil
+	case <-time.After(timeout):
+		c.stopWaitingForFrame(ch)
+		return nil, errors.New("timed out waiting for camera frame")
+	}
 }
 
 type rpcPutRawParams struct {
@@ -206,18 +237,26 @@ func (c *Client) PutFile(path string, r io.ReadCloser, size int) error {
 
 	bs := make([]byte, printFileBlockSize)
 
-	for i := 0; i < size; i += printFileBlockSize {
-		_, err := r.Read(bs)
+	for sent := 0; sent < size; {
+		block := bs
+		if size-sent < len(block) {
+			block = block[:size-sent]
+		}
+
+		n, err := io.ReadFull(r, block)
 		if err != nil {
 			return err
 		}
 
-		checksum.Write(bs)
+		part := bs[:n]
+		checksum.Write(part)
 
-		c.sendFilePart(&bs, &fileID)
+		err = c.sendFilePart(&part, &fileID)
 		if err != nil {
 			return err
 		}
+
+		sent += n
 	}
 
 	bs = nil // explicitly deref
@@ -326,3 +365,90 @@ func (c *Client) CopySSHPublicKey(key []byte) error {
 
 	return c.copySSHID(fp)
 }
+
+type rpcPreheatParams struct {
+	TemperatureSettings []int `json:"temperature_settings"`
+}
+
+// Preheat instructs the printer to begin heating its toolhead(s) to the
+// provided temperatures (in °C), one per toolhead index. Heating progress
+// can be followed with HandleStateChange through each Toolhead's
+// CurrentTemperature and TargetTemperature.
+//
+// This is safe to do while a file is being sent with Print, so you
+// can warm up the extruder while the upload is in progress.
+func (c *Client) Preheat(temperatures ...int) (*PrinterProcess, error) {
+	if len(temperatures) == 0 {
+		return nil, errors.New("at least one temperature must be provided")
+	}
+
+	var reply PrinterProcess
+	return &reply, c.call("preheat", rpcPreheatParams{temperatures}, &reply)
+}
+
+// CancelPreheat instructs the printer to stop preheating its toolhead(s)
+// and let them cool back down.
+func (c *Client) CancelPreheat() (*PrinterProcess, error) {
+	var reply PrinterProcess
+	return &reply, c.call("cancel_preheat", rpcEmptyParams{}, &reply)
+}
+
+type rpcCoolParams struct {
+	ToolIndex int `json:"tool_index"`
+}
+
+// Cooldown instructs the printer to turn off the heater for the toolhead
+// at `toolIndex` and wait for it to cool down.
+func (c *Client) Cooldown(toolIndex int) (*PrinterProcess, error) {
+	var reply PrinterProcess
+	return &reply, c.call("cool", rpcCoolParams{toolIndex}, &reply)
+}
+
+type rpcHomeParams struct {
+	Axes    []string `json:"axes"`
+	Preheat bool     `json:"preheat"`
+}
+
+// Home instructs the printer to home the provided `axes` (e.g. "x", "y",
+// "z"). If no axes are provided, all of them are homed. The returned
+// process will go through StepHoming and StepPositionFound, which can
+// be followed with HandleStepChange.
+func (c *Client) Home(axes ...string) (*PrinterProcess, error) {
+	if len(axes) == 0 {
+		axes = []string{"x", "y", "z"}
+	}
+
+	var reply PrinterProcess
+	return &reply, c.call("home", rpcHomeParams{axes, false}, &reply)
+}
+
+type rpcJogParams struct {
+	Axis     string  `json:"axis"`
+	Distance float64 `json:"point_mm"`
+	FeedRate float64 `json:"mm_per_second"`
+}
+
+// Jog instructs the printer to move `axis` ("x", "y" or "z") by `distance`
+// millimeters at `feedRate` mm/s. Negative distances move the axis
+// backwards.
+func (c *Client) Jog(axis string, distance, feedRate float64) (*PrinterProcess, error) {
+	var reply PrinterProcess
+	return &reply, c.call("jog", rpcJogParams{axis, distance, feedRate}, &reply)
+}
+
+// AssistedLevel instructs the printer to begin its assisted build plate
+// leveling process. The printer will ask for the knobs under the build
+// plate to be turned, so someone needs to be next to it.
+func (c *Client) AssistedLevel() (*PrinterProcess, error) {
+	var reply PrinterProcess
+	return &reply, c.call("assisted_level", rpcEmptyParams{}, &reply)
+}
+
+// CalibrateZOffset instructs the printer to calibrate the distance between
+// the nozzle and the build plate. The returned process will go through
+// StepHoming and StepCalibrating, which can be followed with
+// HandleStepChange.
+func (c *Client) CalibrateZOffset() (*PrinterProcess, error) {
+	var reply PrinterProcess
+	return &reply, c.call("calibrate_z_offset", rpcEmptyParams{}, &reply)
+}
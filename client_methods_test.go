@@ -0,0 +1,83 @@
+package makerbot
+
+import (
+	"bytes"
+	"encoding/json"
+	"hash/crc32"
+	"io/ioutil"
+	"math/rand"
+	"testing"
+	"testing/iotest"
+)
+
+func TestPutFile(t *testing.T) {
+	p := newFakePrinter(t)
+	defer p.Close()
+
+	c := p.connect()
+	defer c.Close()
+
+	// Two full blocks and a short one
+	data := make([]byte, 2*printFileBlockSize+1234)
+	rand.New(rand.NewSource(1)).Read(data)
+
+	// HalfReader returns short reads, like a network connection would
+	r := ioutil.NopCloser(iotest.HalfReader(bytes.NewReader(data)))
+
+	err := c.PutFile("/home/test.bin", r, len(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var received []byte
+	for _, call := range p.received("put_raw") {
+		if len(call.Raw) > printFileBlockSize {
+			t.Errorf("got a %d byte block", len(call.Raw))
+		}
+
+		received = append(received, call.Raw...)
+	}
+
+	if !bytes.Equal(received, data) {
+		t.Errorf("printer received %d bytes that are different from the %d sent", len(received), len(data))
+	}
+
+	terms := p.received("put_term")
+	if len(terms) != 1 {
+		t.Fatalf("got %d put_term calls, wanted 1", len(terms))
+	}
+
+	var term rpcPutTermParams
+	json.Unmarshal(terms[0].Params, &term)
+
+	if term.Checksum != crc32.ChecksumIEEE(data) || term.Length != len(data) {
+		t.Errorf("got CRC %08x for %d bytes, wanted %08x for %d", term.Checksum, term.Length, crc32.ChecksumIEEE(data), len(data))
+	}
+}
+
+func TestPutFileErrors(t *testing.T) {
+	p := newFakePrinter(t)
+	defer p.Close()
+
+	c := p.connect()
+	defer c.Close()
+
+	data := make([]byte, 1000)
+
+	// The file is shorter than the size it was sent with
+	err := c.PutFile("/home/test.bin", ioutil.NopCloser(bytes.NewReader(data)), 2000)
+	if err == nil {
+		t.Error("short file wasn't an error")
+	}
+
+	p.handle("put_raw", func(fakeCall) (interface{}, error) { return nil, errFake })
+
+	err = c.PutFile("/home/test.bin", ioutil.NopCloser(bytes.NewReader(data)), len(data))
+	if err == nil {
+		t.Error("failed put_raw wasn't an error")
+	}
+
+	if len(p.received("put_term")) != 0 {
+		t.Error("put_term was called after a failure")
+	}
+}
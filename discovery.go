@@ -0,0 +1,205 @@
+package makerbot
+
+import (
+	"reflect"
+	"sync"
+	"time"
+)
+
+// DiscoveryEventType is the kind of change a DiscoveryEvent reports
+type DiscoveryEventType int
+
+const (
+	// PrinterAppeared means a printer was seen for the first time
+	PrinterAppeared DiscoveryEventType = iota
+	// PrinterChanged means a printer's details (e.g. its IP or name) changed
+	PrinterChanged
+	// PrinterGone means a printer hasn't been seen for longer than the TTL
+	PrinterGone
+)
+
+func (t DiscoveryEventType) String() string {
+	switch t {
+	case PrinterAppeared:
+		return "PrinterAppeared"
+	case PrinterChanged:
+		return "PrinterChanged"
+	case PrinterGone:
+		return "PrinterGone"
+	}
+
+	return "Unknown"
+}
+
+// DiscoveryEvent is emitted by a Discoverer when the set of printers
+// on the network changes
+type DiscoveryEvent struct {
+	Type    DiscoveryEventType
+	Printer Printer
+}
+
+type discoveredPrinter struct {
+	printer  Printer
+	lastSeen time.Time
+}
+
+// Discoverer keeps watching the LAN for printers, using the same
+// methods as DiscoverPrinters, and reports when they appear, change or
+// go away. Printers are identified by their Serial.
+type Discoverer struct {
+	Interval     time.Duration // Time between queries (default 10 seconds)
+	QueryTimeout time.Duration // How long each query listens for replies (default 2 seconds)
+	TTL          time.Duration // How long a printer can go unseen before it is gone (default 3 Intervals)
+
+	printers map[string]*discoveredPrinter
+	eventCbs []func(DiscoveryEvent)
+	stop     chan struct{}
+	mux      sync.Mutex
+}
+
+// NewDiscoverer creates a Discoverer with the default settings.
+// Call Start to begin discovering printers.
+func NewDiscoverer() *Discoverer {
+	return &Discoverer{
+		Interval:     10 * time.Second,
+		QueryTimeout: 2 * time.Second,
+		printers:     make(map[string]*discoveredPrinter),
+	}
+}
+
+// HandleEvent calls `cb` every time a printer appears, changes or
+// goes away.
+func (d *Discoverer) HandleEvent(cb func(DiscoveryEvent)) {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	d.eventCbs = append(d.eventCbs, cb)
+}
+
+// Printers returns the printers that are currently on the network
+func (d *Discoverer) Printers() []Printer {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	printers := make([]Printer, 0, len(d.printers))
+	for _, p := range d.printers {
+		printers = append(printers, p.printer)
+	}
+
+	return printers
+}
+
+// Start begins querying the network in the background until Stop
+// is called.
+func (d *Discoverer) Start() {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	if d.stop != nil {
+		return
+	}
+
+	if d.Interval <= 0 {
+		d.Interval = 10 * time.Second
+	}
+
+	if d.QueryTimeout <= 0 {
+		d.QueryTimeout = 2 * time.Second
+	}
+
+	if d.TTL <= 0 {
+		d.TTL = 3 * d.Interval
+	}
+
+	stop := make(chan struct{})
+	d.stop = stop
+
+	go func() {
+		ticker := time.NewTicker(d.Interval)
+		defer ticker.Stop()
+
+		for {
+			d.query()
+			d.expire(time.Now())
+
+			select {
+			case <-ticker.C:
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops querying the network. Printers that were found are kept.
+func (d *Discoverer) Stop() {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	if d.stop != nil {
+		close(d.stop)
+		d.stop = nil
+	}
+}
+
+func (d *Discoverer) query() {
+	// Errors are transient (e.g. the network is down); try again next time
+	printers, _ := DiscoverPrinters(d.QueryTimeout)
+	if printers == nil {
+		return
+	}
+
+	now := time.Now()
+	for _, printer := range *printers {
+		d.observe(printer, now)
+	}
+}
+
+func (d *Discoverer) observe(printer Printer, now time.Time) {
+	key := printerKey(&printer)
+
+	d.mux.Lock()
+
+	var ev *DiscoveryEvent
+	if p, ok := d.printers[key]; !ok {
+		d.printers[key] = &discoveredPrinter{printer, now}
+		ev = &DiscoveryEvent{PrinterAppeared, printer}
+	} else {
+		if !reflect.DeepEqual(p.printer, printer) {
+			p.printer = printer
+			ev = &DiscoveryEvent{PrinterChanged, printer}
+		}
+
+		p.lastSeen = now
+	}
+
+	cbs := d.eventCbs
+	d.mux.Unlock()
+
+	if ev != nil {
+		for _, cb := range cbs {
+			cb(*ev)
+		}
+	}
+}
+
+func (d *Discoverer) expire(now time.Time) {
+	d.mux.Lock()
+
+	var gone []DiscoveryEvent
+	for key, p := range d.printers {
+		if now.Sub(p.lastSeen) > d.TTL {
+			delete(d.printers, key)
+			gone = append(gone, DiscoveryEvent{PrinterGone, p.printer})
+		}
+	}
+
+	cbs := d.eventCbs
+	d.mux.Unlock()
+
+	for _, ev := range gone {
+		for _, cb := range cbs {
+			cb(ev)
+		}
+	}
+}
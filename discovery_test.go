@@ -0,0 +1,127 @@
+package makerbot
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/mdns"
+)
+
+func testEntry() *mdns.ServiceEntry {
+	return &mdns.ServiceEntry{
+		Name:   "Replicator._makerbot-jsonrpc._tcp.local.",
+		AddrV6: net.ParseIP("fe80::1"),
+		Port:   9999,
+		InfoFields: []string{
+			"machine_name=The Replicator",
+			"iserial=23C100000000",
+			"vid=9153",
+			"bot_type=replicator_5",
+			"weird=a=b",
+		},
+	}
+}
+
+func TestPrinterFromEntry(t *testing.T) {
+	printer, ok := printerFromEntry(testEntry())
+	if !ok {
+		t.Fatal("entry was not recognized as a printer")
+	}
+
+	if printer.MachineName != "The Replicator" || printer.Serial != "23C100000000" || printer.Vid != 9153 {
+		t.Errorf("TXT fields were parsed wrong; got: %+v\n", printer)
+	}
+
+	if printer.IP != "fe80::1" || printer.Port != "9999" {
+		t.Errorf("address is wrong; wanted: fe80::1 9999, got: %s %s\n", printer.IP, printer.Port)
+	}
+
+	if fields := parseInfoFields([]string{"weird=a=b"}); fields["weird"] != "a=b" {
+		t.Errorf("value containing = was parsed wrong; got: %s\n", fields["weird"])
+	}
+}
+
+func TestDiscovererEvents(t *testing.T) {
+	d := NewDiscoverer()
+	d.TTL = time.Minute
+
+	var events []DiscoveryEvent
+	d.HandleEvent(func(ev DiscoveryEvent) { events = append(events, ev) })
+
+	printer, _ := printerFromEntry(testEntry())
+	now := time.Now()
+
+	d.observe(*printer, now)
+	d.observe(*printer, now.Add(time.Second))
+
+	printer.IP = "192.168.1.2"
+	d.observe(*printer, now.Add(2*time.Second))
+
+	d.expire(now.Add(30 * time.Second))
+	d.expire(now.Add(2 * time.Minute))
+
+	want := []DiscoveryEventType{PrinterAppeared, PrinterChanged, PrinterGone}
+	if len(events) != len(want) {
+		t.Fatalf("wrong number of events; wanted: %d, got: %d\n", len(want), len(events))
+	}
+
+	for i, ev := range events {
+		if ev.Type != want[i] || ev.Printer.Serial != "23C100000000" {
+			t.Errorf("event %d is wrong; wanted: %s, got: %s %+v\n", i, want[i], ev.Type, ev.Printer)
+		}
+	}
+
+	if len(d.Printers()) != 0 {
+		t.Errorf("printer was not removed after expiring")
+	}
+}
+
+func TestDiscoverBroadcast(t *testing.T) {
+	responder, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer responder.Close()
+
+	go func() {
+		buf := make([]byte, 1024)
+		n, from, err := responder.ReadFromUDP(buf)
+		if err != nil || string(buf[:n]) != broadcastProbe {
+			return
+		}
+
+		reply := `{"machine_name": "The Replicator", "iserial": "23C100000000", "port": 9999, "firmware_version": {"major": 2}}`
+		responder.WriteToUDP([]byte(reply), from)
+		responder.WriteToUDP([]byte(reply), from) // duplicates are dropped
+	}()
+
+	printers, err := discoverBroadcast(responder.LocalAddr().(*net.UDPAddr), 200*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(*printers) != 1 {
+		t.Fatalf("wrong number of printers; wanted: 1, got: %d\n", len(*printers))
+	}
+
+	p := (*printers)[0]
+	if p.IP != "127.0.0.1" || p.Port != "9999" || p.FirmwareVersion.Major != 2 {
+		t.Errorf("printer was parsed wrong; got: %+v\n", p)
+	}
+}
+
+func TestMergePrinters(t *testing.T) {
+	fromMDNS, _ := printerFromEntry(testEntry())
+	fromBroadcast := Printer{Serial: fromMDNS.Serial, IP: "192.168.1.2", FirmwareVersion: FirmwareVersion{Major: 2}}
+	other := Printer{Serial: "other", IP: "192.168.1.3"}
+
+	merged := mergePrinters(&[]Printer{*fromMDNS}, &[]Printer{fromBroadcast, other})
+	if len(merged) != 2 {
+		t.Fatalf("wrong number of printers; wanted: 2, got: %d\n", len(merged))
+	}
+
+	if merged[0].IP != "fe80::1" || merged[0].FirmwareVersion.Major != 2 {
+		t.Errorf("printers were merged wrong; got: %+v\n", merged[0])
+	}
+}
@@ -0,0 +1,336 @@
+// Package dvr keeps a rolling buffer of a MakerBot printer's camera and
+// saves it to disk when a print goes wrong.
+package dvr
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	makerbot "github.com/tjhorner/makerbot-rpc"
+	"github.com/tjhorner/makerbot-rpc/camera"
+)
+
+// Options configures a DVR
+type Options struct {
+	Dir       string        // Directory clips are saved to
+	Window    time.Duration // How much footage to keep (default 5 minutes)
+	MaxBytes  int           // Upper bound on the size of the buffered frames (default 256 MB)
+	BufferDir string        // If set, buffered frames are kept in this directory instead of in memory
+}
+
+// StateSnapshot is a printer state received at a point in time
+type StateSnapshot struct {
+	Time  time.Time                 `json:"time"`
+	State *makerbot.PrinterMetadata `json:"state"`
+}
+
+// Clip is footage saved by the DVR
+type Clip struct {
+	Reason  string          `json:"reason"` // Why the clip was saved, e.g. the step the print moved to
+	Start   time.Time       `json:"start"`  // Time of the first frame
+	End     time.Time       `json:"end"`    // Time of the last frame
+	Frames  int             `json:"frames"` // Number of frames in the video
+	Video   string          `json:"video"`  // Path of the MJPEG AVI video
+	Sidecar string          `json:"-"`      // Path of the JSON sidecar, which holds this Clip
+	States  []StateSnapshot `json:"states"` // Printer states received during the clip
+}
+
+type entry struct {
+	time time.Time
+	data []byte // nil if stored on disk
+	path string // empty if stored in memory
+	size int
+}
+
+// DVR keeps the last Options.Window of camera frames and printer states.
+// When a print moves to StepFailed, StepError or
+// StepHandlingRecoverableFilamentJam, the buffered footage is saved as
+// a clip.
+type DVR struct {
+	opts   Options
+	frames []entry
+	states []StateSnapshot
+	bytes  int
+	seq    int
+	saving int      // number of Saves reading buffered frames from disk
+	stale  []string // frames evicted during a Save, removed once it is done
+	sub    makerbot.CameraSubscription
+	remove func() // removes the state handler
+	clipCb *func(*Clip, error)
+	mux    sync.Mutex
+}
+
+// New creates a DVR. Frames and states need to be fed to it with
+// FrameHandler and StateHandler; see Attach for doing so from a Client.
+func New(opts Options) (*DVR, error) {
+	if opts.Window <= 0 {
+		opts.Window = 5 * time.Minute
+	}
+
+	if opts.MaxBytes <= 0 {
+		opts.MaxBytes = 256 * 1024 * 1024
+	}
+
+	if opts.BufferDir != "" {
+		err := os.MkdirAll(opts.BufferDir, 0755)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &DVR{opts: opts}, nil
+}
+
+// Attach creates a DVR that records from `c` until Stop is called
+func Attach(c *makerbot.Client, opts Options) (*DVR, error) {
+	d, err := New(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	remove := c.HandleStateChange(d.StateHandler())
+
+	sub, err := c.HandleCameraFrame(d.FrameHandler())
+	if err != nil {
+		remove()
+		return nil, err
+	}
+
+	d.sub = sub
+	d.remove = remove
+	return d, nil
+}
+
+// HandleClip calls `cb` every time the DVR saves a clip on its own.
+// `err` is non-nil if the clip could not be saved.
+func (d *DVR) HandleClip(cb func(clip *Clip, err error)) {
+	d.clipCb = &cb
+}
+
+// Stop stops receiving camera frames and printer states (if the DVR was
+// attached to a Client) and drops the buffer.
+func (d *DVR) Stop() error {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	if d.remove != nil {
+		d.remove()
+		d.remove = nil
+	}
+
+	var err error
+	if d.sub != nil {
+		err = d.sub.Stop()
+		d.sub = nil
+	}
+
+	d.evict(time.Now(), 0)
+
+	return err
+}
+
+// FrameHandler returns a function suitable for Client.HandleCameraFrame
+func (d *DVR) FrameHandler() func(frame *makerbot.CameraFrame) {
+	return func(frame *makerbot.CameraFrame) {
+		data, err := frame.JPEG(makerbot.FrameEncodeOptions{})
+		if err != nil {
+			return
+		}
+
+		d.addFrame(time.Now(), data)
+	}
+}
+
+// StateHandler returns a function suitable for Client.HandleStateChange
+func (d *DVR) StateHandler() func(old, new *makerbot.PrinterMetadata) {
+	return func(old, new *makerbot.PrinterMetadata) {
+		now := time.Now()
+
+		d.mux.Lock()
+		d.states = append(d.states, StateSnapshot{now, new})
+		d.evict(now.Add(-d.opts.Window), d.opts.MaxBytes)
+		d.mux.Unlock()
+
+		if new == nil || new.CurrentProcess == nil {
+			return
+		}
+
+		step := new.CurrentProcess.Step
+		if !triggers(step) {
+			return
+		}
+
+		if old != nil && old.CurrentProcess != nil && old.CurrentProcess.ID == new.CurrentProcess.ID && old.CurrentProcess.Step == step {
+			return
+		}
+
+		clip, err := d.Save(step.String())
+		if d.clipCb != nil {
+			(*d.clipCb)(clip, err)
+		}
+	}
+}
+
+func triggers(step makerbot.PrintProcessStep) bool {
+	switch step {
+	case makerbot.StepFailed, makerbot.StepError, makerbot.StepHandlingRecoverableFilamentJam:
+		return true
+	}
+
+	return false
+}
+
+func (d *DVR) addFrame(t time.Time, data []byte) {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	e := entry{time: t, size: len(data)}
+
+	if d.opts.BufferDir == "" {
+		e.data = data
+	} else {
+		e.path = filepath.Join(d.opts.BufferDir, fmt.Sprintf("frame_%09d.jpg", d.seq))
+		d.seq++
+
+		err := ioutil.WriteFile(e.path, data, 0644)
+		if err != nil {
+			return
+		}
+	}
+
+	d.frames = append(d.frames, e)
+	d.bytes += e.size
+
+	d.evict(t.Add(-d.opts.Window), d.opts.MaxBytes)
+}
+
+// evict drops frames and states older than `before`, then drops the
+// oldest frames until the buffer is at most `maxBytes` large.
+func (d *DVR) evict(before time.Time, maxBytes int) {
+	n := 0
+	for n < len(d.frames) && (d.frames[n].time.Before(before) || d.bytes > maxBytes) {
+		if d.frames[n].path != "" {
+			if d.saving > 0 {
+				d.stale = append(d.stale, d.frames[n].path)
+			} else {
+				os.Remove(d.frames[n].path)
+			}
+		}
+
+		d.bytes -= d.frames[n].size
+		n++
+	}
+	d.frames = append(d.frames[:0], d.frames[n:]...)
+
+	n = 0
+	for n < len(d.states) && d.states[n].Time.Before(before) {
+		n++
+	}
+	d.states = append(d.states[:0], d.states[n:]...)
+}
+
+// Save writes the buffered footage to Options.Dir as an MJPEG AVI
+// video, next to a JSON sidecar holding the Clip with the printer
+// states from the same period. `reason` ends up in the file names.
+//
+// The buffer is only locked while the frames are copied, so the DVR
+// keeps recording while the video is written.
+func (d *DVR) Save(reason string) (*Clip, error) {
+	d.mux.Lock()
+
+	frames := append([]entry(nil), d.frames...)
+	states := append([]StateSnapshot(nil), d.states...)
+	d.saving++
+
+	d.mux.Unlock()
+	defer d.doneSaving()
+
+	if len(frames) == 0 {
+		return nil, fmt.Errorf("no frames buffered")
+	}
+
+	err := os.MkdirAll(d.opts.Dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	start, end := frames[0].time, frames[len(frames)-1].time
+	base := filepath.Join(d.opts.Dir, fmt.Sprintf("%s_%s", end.Format("20060102-150405"), reason))
+
+	clip := &Clip{
+		Reason:  reason,
+		Start:   start,
+		End:     end,
+		Frames:  len(frames),
+		Video:   base + ".avi",
+		Sidecar: base + ".json",
+		States:  states,
+	}
+
+	// Play back at roughly real time
+	fps := 1
+	if secs := end.Sub(start).Seconds(); secs > 0 {
+		fps = int(math.Max(1, math.Round(float64(len(frames)-1)/secs)))
+	}
+
+	f, err := os.Create(clip.Video)
+	if err != nil {
+		return nil, err
+	}
+
+	if d.opts.BufferDir == "" {
+		data := make([][]byte, len(frames))
+		for i, e := range frames {
+			data[i] = e.data
+		}
+
+		err = camera.WriteAVI(f, data, fps)
+	} else {
+		paths := make([]string, len(frames))
+		for i, e := range frames {
+			paths[i] = e.path
+		}
+
+		err = camera.WriteAVIFiles(f, paths, fps)
+	}
+
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	err = f.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	sidecar, err := json.MarshalIndent(clip, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	return clip, ioutil.WriteFile(clip.Sidecar, sidecar, 0644)
+}
+
+// doneSaving removes the frames that were evicted while the last Save
+// was still reading them
+func (d *DVR) doneSaving() {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	d.saving--
+	if d.saving > 0 {
+		return
+	}
+
+	for _, path := range d.stale {
+		os.Remove(path)
+	}
+	d.stale = nil
+}
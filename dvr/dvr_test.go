@@ -0,0 +1,164 @@
+package dvr_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/jpeg"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	makerbot "github.com/tjhorner/makerbot-rpc"
+	"github.com/tjhorner/makerbot-rpc/dvr"
+)
+
+func frame() *makerbot.CameraFrame {
+	var buf bytes.Buffer
+	jpeg.Encode(&buf, image.NewGray(image.Rect(0, 0, 16, 8)), nil)
+
+	return &makerbot.CameraFrame{
+		Data:     buf.Bytes(),
+		Metadata: &makerbot.CameraFrameMetadata{FileSize: uint32(buf.Len()), Width: 16, Height: 8, Format: makerbot.CameraFrameFormatJPEG},
+	}
+}
+
+func state(t *testing.T, process string) *makerbot.PrinterMetadata {
+	var m makerbot.PrinterMetadata
+	err := json.Unmarshal([]byte(`{"current_process": `+process+`}`), &m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &m
+}
+
+func TestSaveOnFailure(t *testing.T) {
+	for _, bufferDir := range []string{"", "buffer"} {
+		dir, err := ioutil.TempDir("", "dvr")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		opts := dvr.Options{Dir: filepath.Join(dir, "clips")}
+		if bufferDir != "" {
+			opts.BufferDir = filepath.Join(dir, bufferDir)
+		}
+
+		d, err := dvr.New(opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var clips []*dvr.Clip
+		d.HandleClip(func(clip *dvr.Clip, err error) {
+			if err != nil {
+				t.Error(err)
+			}
+			clips = append(clips, clip)
+		})
+
+		onFrame, onState := d.FrameHandler(), d.StateHandler()
+
+		printing := state(t, `{"id": 1, "step": "printing"}`)
+		onState(nil, printing)
+
+		for i := 0; i < 5; i++ {
+			onFrame(frame())
+		}
+
+		failed := state(t, `{"id": 1, "step": "failed"}`)
+		onState(printing, failed)
+		onState(failed, failed) // should not save twice
+
+		if len(clips) != 1 {
+			t.Fatalf("wrong number of clips; wanted: 1, got: %d\n", len(clips))
+		}
+
+		clip := clips[0]
+		if clip.Frames != 5 || clip.Reason != "failed" || len(clip.States) != 2 {
+			t.Errorf("clip is wrong; got: %+v\n", clip)
+		}
+
+		for _, path := range []string{clip.Video, clip.Sidecar} {
+			if _, err := os.Stat(path); err != nil {
+				t.Errorf("clip file is missing: %s\n", err)
+			}
+		}
+	}
+}
+
+func TestMaxBytes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dvr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	f := frame()
+	d, err := dvr.New(dvr.Options{Dir: dir, BufferDir: filepath.Join(dir, "buffer"), MaxBytes: len(f.Data) * 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	onFrame := d.FrameHandler()
+	for i := 0; i < 10; i++ {
+		onFrame(f)
+	}
+
+	buffered, _ := ioutil.ReadDir(filepath.Join(dir, "buffer"))
+	if len(buffered) != 3 {
+		t.Errorf("wrong number of buffered frames on disk; wanted: 3, got: %d\n", len(buffered))
+	}
+
+	clip, err := d.Save("manual")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if clip.Frames != 3 {
+		t.Errorf("wrong number of frames in clip; wanted: 3, got: %d\n", clip.Frames)
+	}
+}
+
+func TestSaveWhileRecording(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dvr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	f := frame()
+	d, err := dvr.New(dvr.Options{Dir: dir, BufferDir: filepath.Join(dir, "buffer"), MaxBytes: len(f.Data) * 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	onFrame := d.FrameHandler()
+	onFrame(f)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 200; i++ {
+			onFrame(f)
+		}
+	}()
+
+	for i := 0; i < 20; i++ {
+		_, err := d.Save(strconv.Itoa(i))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	<-done
+
+	// Frames evicted while a Save was reading them are removed afterwards
+	buffered, _ := ioutil.ReadDir(filepath.Join(dir, "buffer"))
+	if len(buffered) != 3 {
+		t.Errorf("wrong number of buffered frames on disk; wanted: 3, got: %d\n", len(buffered))
+	}
+}
@@ -0,0 +1,233 @@
+package makerbot
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"sync"
+	"testing"
+)
+
+// fakeCall is a JSON-RPC call received by a fakePrinter
+type fakeCall struct {
+	Method string
+	Params json.RawMessage
+	Raw    []byte // Data sent after a put_raw call
+}
+
+// fakePrinter is a JSON-RPC server that behaves enough like a printer
+// for a Client to connect to it. Calls are answered by the handler for
+// their method; methods without one return true, and handlers that
+// return an error send a JSON-RPC error.
+type fakePrinter struct {
+	t        *testing.T
+	l        net.Listener
+	mux      sync.Mutex
+	handlers map[string]func(fakeCall) (interface{}, error)
+	calls    []fakeCall
+	conns    []net.Conn
+}
+
+type fakePacket struct {
+	ID      *string         `json:"id,omitempty"`
+	Version string          `json:"jsonrpc"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *rpcErrorBody   `json:"error,omitempty"`
+}
+
+type rpcErrorBody struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func newFakePrinter(t *testing.T) *fakePrinter {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := &fakePrinter{
+		t: t,
+		l: l,
+		handlers: map[string]func(fakeCall) (interface{}, error){
+			"handshake": func(fakeCall) (interface{}, error) {
+				return map[string]interface{}{
+					"machine_name":     "Fake Bot",
+					"bot_type":         "replicator_b",
+					"firmware_version": map[string]int{"major": 2, "minor": 0, "bugfix": 0, "build": 1},
+				}, nil
+			},
+		},
+	}
+
+	go p.serve()
+	return p
+}
+
+// handle sets the handler for `method`
+func (p *fakePrinter) handle(method string, h func(fakeCall) (interface{}, error)) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	p.handlers[method] = h
+}
+
+// received returns the calls to `method` received so far
+func (p *fakePrinter) received(method string) []fakeCall {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	var calls []fakeCall
+	for _, c := range p.calls {
+		if c.Method == method {
+			calls = append(calls, c)
+		}
+	}
+
+	return calls
+}
+
+// connect returns a Client connected to the fake printer
+func (p *fakePrinter) connect() *Client {
+	c := NewClient()
+
+	host, port, _ := net.SplitHostPort(p.l.Addr().String())
+	err := c.ConnectLocal(host, port)
+	if err != nil {
+		p.t.Fatal(err)
+	}
+
+	return &c
+}
+
+// notify sends a notification to every connected client
+func (p *fakePrinter) notify(method string, params interface{}) {
+	b, _ := json.Marshal(params)
+	packet, _ := json.Marshal(fakePacket{Version: "2.0", Method: method, Params: b})
+	p.write(packet)
+}
+
+// write sends raw data to every connected client
+func (p *fakePrinter) write(b []byte) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	for _, conn := range p.conns {
+		conn.Write(b)
+	}
+}
+
+// Close stops the fake printer and closes its connections
+func (p *fakePrinter) Close() {
+	p.l.Close()
+
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	for _, conn := range p.conns {
+		conn.Close()
+	}
+}
+
+func (p *fakePrinter) serve() {
+	for {
+		conn, err := p.l.Accept()
+		if err != nil {
+			return
+		}
+
+		p.mux.Lock()
+		p.conns = append(p.conns, conn)
+		p.mux.Unlock()
+
+		go p.serveConn(conn)
+	}
+}
+
+func (p *fakePrinter) serveConn(conn net.Conn) {
+	defer conn.Close()
+
+	r := &prefixReader{r: conn}
+	for {
+		dec := json.NewDecoder(r)
+
+		var req fakePacket
+		if dec.Decode(&req) != nil {
+			return
+		}
+
+		// The decoder reads ahead, and raw data follows put_raw
+		buffered, _ := ioutil.ReadAll(dec.Buffered())
+		r.buf = append(buffered, r.buf...)
+
+		call := fakeCall{Method: req.Method, Params: req.Params}
+
+		p.mux.Lock()
+		h, ok := p.handlers[req.Method]
+		p.mux.Unlock()
+
+		var (
+			result interface{} = true
+			err    error
+		)
+
+		if ok {
+			result, err = h(call)
+		}
+
+		resp := fakePacket{ID: req.ID, Version: "2.0", Result: result}
+		if err != nil {
+			resp = fakePacket{ID: req.ID, Version: "2.0", Error: &rpcErrorBody{-1, err.Error()}}
+		}
+
+		p.mux.Lock()
+		writeFakePacket(conn, resp)
+		p.mux.Unlock()
+
+		// The client sends the data once put_raw is answered
+		if req.Method == "put_raw" && err == nil {
+			var params rpcPutRawParams
+			json.Unmarshal(req.Params, &params)
+
+			call.Raw = make([]byte, params.Length)
+			if _, err := io.ReadFull(r, call.Raw); err != nil {
+				return
+			}
+		}
+
+		p.mux.Lock()
+		p.calls = append(p.calls, call)
+		p.mux.Unlock()
+	}
+}
+
+// prefixReader reads `buf` before reading from `r`
+type prefixReader struct {
+	buf []byte
+	r   io.Reader
+}
+
+func (p *prefixReader) Read(b []byte) (int, error) {
+	if len(p.buf) > 0 {
+		n := copy(b, p.buf)
+		p.buf = p.buf[n:]
+		return n, nil
+	}
+
+	return p.r.Read(b)
+}
+
+func writeFakePacket(conn net.Conn, packet fakePacket) {
+	b, err := json.Marshal(packet)
+	if err != nil {
+		panic(err)
+	}
+
+	conn.Write(b)
+}
+
+var errFake = errors.New("fake error")
@@ -0,0 +1,229 @@
+package makerbot
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+const firmwareRemotePath = "/home/firmware.zip"
+
+// FirmwareVersion is the version of the firmware a printer is running
+type FirmwareVersion struct {
+	Major  int `json:"major"`
+	Minor  int `json:"minor"`
+	Bugfix int `json:"bugfix"`
+	Build  int `json:"build"`
+}
+
+func (v FirmwareVersion) String() string {
+	return fmt.Sprintf("%d.%d.%d.%d", v.Major, v.Minor, v.Bugfix, v.Build)
+}
+
+// Compare returns -1 if `v` is older than `o`, 1 if it is newer,
+// and 0 if both versions are the same.
+func (v FirmwareVersion) Compare(o FirmwareVersion) int {
+	a := []int{v.Major, v.Minor, v.Bugfix, v.Build}
+	b := []int{o.Major, o.Minor, o.Bugfix, o.Build}
+
+	for i := range a {
+		if a[i] < b[i] {
+			return -1
+		}
+
+		if a[i] > b[i] {
+			return 1
+		}
+	}
+
+	return 0
+}
+
+// FirmwareUpdate describes a firmware update to be performed with
+// UpdateFirmware.
+type FirmwareUpdate struct {
+	Version        FirmwareVersion       // Version of the firmware contained in the bundle
+	DryRun         bool                  // Only check that the update is compatible; nothing is sent to the printer
+	AllowDowngrade bool                  // Allow installing a version older than the one currently running
+	RebootTimeout  time.Duration         // How long to wait for the printer to come back after rebooting (default 10 minutes)
+	Progress       func(*PrinterProcess) // Called every time the update process changes, may be nil
+}
+
+// CheckFirmwareCompatibility returns an error if firmware `version` cannot
+// be installed on the printer this Client is connected to.
+func (c *Client) CheckFirmwareCompatibility(version FirmwareVersion, allowDowngrade bool) error {
+	if c.Printer == nil {
+		return errors.New("client has not performed a handshake with the printer")
+	}
+
+	switch version.Compare(c.Printer.FirmwareVersion) {
+	case 0:
+		return fmt.Errorf("printer is already running firmware %s", version)
+	case -1:
+		if !allowDowngrade {
+			return fmt.Errorf("firmware %s is older than the installed firmware %s", version, c.Printer.FirmwareVersion)
+		}
+	}
+
+	return nil
+}
+
+type rpcFirmwareUpdateParams struct {
+	FilePath string `json:"filepath"`
+}
+
+func (c *Client) startFirmwareUpdate(path string) (*PrinterProcess, error) {
+	var reply PrinterProcess
+	return &reply, c.call("brooklyn_upload", rpcFirmwareUpdateParams{path}, &reply)
+}
+
+// UpdateFirmware sends a firmware bundle to the printer and installs it.
+// `r` should be the contents of the bundle and `size` its length.
+//
+// The function returns once the printer has rebooted and reports the new
+// FirmwareVersion in its handshake. Since the printer reboots, this
+// Client will be disconnected and should not be used afterwards; create
+// a new one instead. This only works with local connections.
+//
+// If `u.DryRun` is true, only CheckFirmwareCompatibility is performed.
+func (c *Client) UpdateFirmware(r io.ReadCloser, size int, u FirmwareUpdate) error {
+	err := c.CheckFirmwareCompatibility(u.Version, u.AllowDowngrade)
+	if err != nil || u.DryRun {
+		return err
+	}
+
+	if u.RebootTimeout == 0 {
+		u.RebootTimeout = 10 * time.Minute
+	}
+
+	var (
+		mux  sync.Mutex
+		done bool
+		id   = -1
+	)
+
+	result := make(chan error, 1)
+	finish := func(err error) {
+		if done {
+			return
+		}
+
+		done = true
+		result <- err
+	}
+
+	remove := c.HandleStateChange(func(old, new *PrinterMetadata) {
+		mux.Lock()
+		defer mux.Unlock()
+
+		if done || new == nil || new.CurrentProcess == nil || new.CurrentProcess.ID != id {
+			return
+		}
+
+		proc := new.CurrentProcess
+		if u.Progress != nil {
+			u.Progress(proc)
+		}
+
+		switch proc.Step {
+		case StepFailed, StepError:
+			reason := "unknown reason"
+			if proc.Reason != nil {
+				reason = *proc.Reason
+			}
+
+			finish(fmt.Errorf("firmware update failed: %s", reason))
+		default:
+			if proc.Cancelled {
+				finish(errors.New("firmware update was cancelled"))
+			} else if proc.Complete {
+				finish(nil)
+			}
+		}
+	})
+	defer remove()
+
+	err = c.PutFile(firmwareRemotePath, r, size)
+	if err != nil {
+		return err
+	}
+
+	proc, err := c.startFirmwareUpdate(firmwareRemotePath)
+	if err != nil {
+		return err
+	}
+
+	mux.Lock()
+	id = proc.ID
+	mux.Unlock()
+
+	// The printer will reboot once it is done, so a disconnect is
+	// just as good as a completed process
+	select {
+	case err = <-result:
+		if err != nil {
+			return err
+		}
+	case <-c.disconnected:
+	}
+
+	mux.Lock()
+	done = true
+	mux.Unlock()
+
+	return c.waitForFirmware(u.Version, u.RebootTimeout)
+}
+
+// UpdateFirmwareFile is a convenience method for UpdateFirmware, taking in
+// a `filename` and automatically reading from it then feeding it to
+// UpdateFirmware.
+func (c *Client) UpdateFirmwareFile(filename string, u FirmwareUpdate) error {
+	fil, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer fil.Close()
+
+	stat, err := fil.Stat()
+	if err != nil {
+		return err
+	}
+
+	return c.UpdateFirmware(fil, int(stat.Size()), u)
+}
+
+// waitForFirmware reconnects to the printer until it comes back
+// after a reboot, then checks that it is running `version`.
+func (c *Client) waitForFirmware(version FirmwareVersion, timeout time.Duration) error {
+	c.Close()
+
+	deadline := time.Now().Add(timeout)
+
+	for time.Now().Before(deadline) {
+		time.Sleep(10 * time.Second)
+
+		nc := NewClient()
+		nc.SetVerbose(c.verbose)
+
+		err := nc.ConnectLocal(c.IP, c.Port)
+		if err != nil {
+			c.logVerbose("printer is not back yet: %s", err)
+			nc.Close()
+			continue
+		}
+
+		installed := nc.Printer.FirmwareVersion
+		nc.Close()
+
+		if installed.Compare(version) != 0 {
+			return fmt.Errorf("printer is running firmware %s after update, wanted %s", installed, version)
+		}
+
+		return nil
+	}
+
+	return fmt.Errorf("printer did not come back within %s after firmware update", timeout)
+}
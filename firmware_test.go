@@ -0,0 +1,78 @@
+package makerbot
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUpdateFirmwareFailed(t *testing.T) {
+	p := newFakePrinter(t)
+	defer p.Close()
+
+	p.handle("brooklyn_upload", func(fakeCall) (interface{}, error) {
+		return map[string]interface{}{"id": 7, "step": "transfer"}, nil
+	})
+
+	c := p.connect()
+	defer c.Close()
+
+	done := make(chan struct{})
+	defer close(done)
+
+	// Keep reporting the failure, since it can't be known when the
+	// update's state callback is registered
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-time.After(20 * time.Millisecond):
+				p.notify("state_notification", map[string]interface{}{
+					"info": map[string]interface{}{
+						"current_process": map[string]interface{}{"id": 7, "step": "failed", "reason": "bad bundle"},
+					},
+				})
+			}
+		}
+	}()
+
+	bundle := []byte("firmware")
+	err := c.UpdateFirmware(ioutil.NopCloser(bytes.NewReader(bundle)), len(bundle), FirmwareUpdate{
+		Version: FirmwareVersion{Major: 3},
+	})
+	if err == nil || !strings.Contains(err.Error(), "bad bundle") {
+		t.Fatalf("got %v, wanted the failure reason", err)
+	}
+
+	c.stateMux.Lock()
+	defer c.stateMux.Unlock()
+
+	if len(c.stateCbs) != 0 {
+		t.Errorf("%d state callbacks are left after the update", len(c.stateCbs))
+	}
+}
+
+func TestUpdateFirmwareDryRun(t *testing.T) {
+	p := newFakePrinter(t)
+	defer p.Close()
+
+	c := p.connect()
+	defer c.Close()
+
+	err := c.UpdateFirmware(nil, 0, FirmwareUpdate{Version: FirmwareVersion{Major: 1}, DryRun: true})
+	if err == nil {
+		t.Error("downgrade wasn't refused")
+	}
+
+	err = c.UpdateFirmware(nil, 0, FirmwareUpdate{Version: FirmwareVersion{Major: 3}, DryRun: true})
+	if err != nil {
+		t.Error(err)
+	}
+
+	if len(p.received("put_init")) != 0 {
+		t.Error("dry run sent the firmware")
+	}
+}
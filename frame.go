@@ -0,0 +1,216 @@
+package makerbot
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+)
+
+// FrameEncodeOptions controls how a CameraFrame is re-encoded
+type FrameEncodeOptions struct {
+	Width   int // Width of the output image in pixels; 0 keeps the aspect ratio (or the original size if Height is 0 too)
+	Height  int // Height of the output image in pixels; 0 keeps the aspect ratio (or the original size if Width is 0 too)
+	Quality int // JPEG quality between 1 and 100; 0 uses jpeg.DefaultQuality. Ignored for PNG
+}
+
+// Image decodes the frame into an image.Image. Both YUYV and JPEG
+// frames are supported.
+func (f *CameraFrame) Image() (image.Image, error) {
+	if f.Metadata == nil {
+		return nil, errors.New("camera frame has no metadata")
+	}
+
+	switch f.Metadata.Format {
+	case CameraFrameFormatJPEG:
+		return jpeg.Decode(bytes.NewReader(f.Data))
+	case CameraFrameFormatYUYV:
+		return decodeYUYV(f.Data, int(f.Metadata.Width), int(f.Metadata.Height))
+	}
+
+	return nil, fmt.Errorf("unsupported camera frame format %d", f.Metadata.Format)
+}
+
+// decodeYUYV decodes packed YUYV 4:2:2 data, where every 4 bytes
+// (Y0 U Y1 V) describe 2 horizontally adjacent pixels. Cameras send
+// limited-range BT.601 values, so they are expanded to full range.
+func decodeYUYV(data []byte, width, height int) (image.Image, error) {
+	if width <= 0 || height <= 0 || width%2 != 0 {
+		return nil, fmt.Errorf("invalid YUYV frame dimensions %dx%d", width, height)
+	}
+
+	if len(data) < width*height*2 {
+		return nil, fmt.Errorf("YUYV frame is too short; wanted %d bytes, got %d", width*height*2, len(data))
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	for i, o := 0, 0; i < width*height*2; i, o = i+4, o+8 {
+		u, v := int(data[i+1])-128, int(data[i+3])-128
+
+		yuvToRGBA(img.Pix[o:o+4], int(data[i]), u, v)
+		yuvToRGBA(img.Pix[o+4:o+8], int(data[i+2]), u, v)
+	}
+
+	return img, nil
+}
+
+func yuvToRGBA(px []byte, y, u, v int) {
+	c := 298 * (y - 16)
+
+	px[0] = clampUint8((c + 409*v + 128) >> 8)
+	px[1] = clampUint8((c - 100*u - 208*v + 128) >> 8)
+	px[2] = clampUint8((c + 516*u + 128) >> 8)
+	px[3] = 0xff
+}
+
+func clampUint8(v int) uint8 {
+	if v < 0 {
+		return 0
+	}
+
+	if v > 255 {
+		return 255
+	}
+
+	return uint8(v)
+}
+
+// JPEG returns the frame encoded as a JPEG. If the frame already is a
+// JPEG and no resizing or quality is requested, its data is returned
+// as-is.
+func (f *CameraFrame) JPEG(opts FrameEncodeOptions) ([]byte, error) {
+	if f.Metadata != nil && f.Metadata.Format == CameraFrameFormatJPEG && opts == (FrameEncodeOptions{}) {
+		return f.Data, nil
+	}
+
+	img, err := f.encodable(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	quality := opts.Quality
+	if quality == 0 {
+		quality = jpeg.DefaultQuality
+	}
+
+	var buf bytes.Buffer
+	err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality})
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// PNG returns the frame encoded as a PNG.
+func (f *CameraFrame) PNG(opts FrameEncodeOptions) ([]byte, error) {
+	img, err := f.encodable(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	err = png.Encode(&buf, img)
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (f *CameraFrame) encodable(opts FrameEncodeOptions) (image.Image, error) {
+	img, err := f.Image()
+	if err != nil {
+		return nil, err
+	}
+
+	b := img.Bounds()
+	width, height := opts.Width, opts.Height
+
+	switch {
+	case width == 0 && height == 0:
+		return img, nil
+	case width == 0:
+		width = b.Dx() * height / b.Dy()
+	case height == 0:
+		height = b.Dy() * width / b.Dx()
+	}
+
+	if width <= 0 || height <= 0 {
+		return nil, fmt.Errorf("invalid output dimensions %dx%d", width, height)
+	}
+
+	return resize(img, width, height), nil
+}
+
+// resize scales `src` to `width`x`height` with bilinear interpolation.
+func resize(src image.Image, width, height int) image.Image {
+	b := src.Bounds()
+
+	rgba := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), src, b.Min, draw.Src)
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	sx := float64(b.Dx()) / float64(width)
+	sy := float64(b.Dy()) / float64(height)
+
+	for y := 0; y < height; y++ {
+		fy := (float64(y)+0.5)*sy - 0.5
+		y0, wy := bilinearIndex(fy, b.Dy())
+
+		for x := 0; x < width; x++ {
+			fx := (float64(x)+0.5)*sx - 0.5
+			x0, wx := bilinearIndex(fx, b.Dx())
+
+			x1, y1 := minInt(x0+1, b.Dx()-1), minInt(y0+1, b.Dy()-1)
+
+			c00 := rgba.RGBAAt(x0, y0)
+			c10 := rgba.RGBAAt(x1, y0)
+			c01 := rgba.RGBAAt(x0, y1)
+			c11 := rgba.RGBAAt(x1, y1)
+
+			lerp := func(a, b, c, d uint8) uint8 {
+				top := float64(a)*(1-wx) + float64(b)*wx
+				bottom := float64(c)*(1-wx) + float64(d)*wx
+				return uint8(top*(1-wy) + bottom*wy + 0.5)
+			}
+
+			dst.SetRGBA(x, y, color.RGBA{
+				R: lerp(c00.R, c10.R, c01.R, c11.R),
+				G: lerp(c00.G, c10.G, c01.G, c11.G),
+				B: lerp(c00.B, c10.B, c01.B, c11.B),
+				A: lerp(c00.A, c10.A, c01.A, c11.A),
+			})
+		}
+	}
+
+	return dst
+}
+
+// bilinearIndex returns the integer part of `f` clamped to [0, size) and the
+// fractional weight towards the next pixel.
+func bilinearIndex(f float64, size int) (int, float64) {
+	if f < 0 {
+		return 0, 0
+	}
+
+	i := int(f)
+	if i >= size-1 {
+		return size - 1, 0
+	}
+
+	return i, f - float64(i)
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+
+	return b
+}
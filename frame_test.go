@@ -0,0 +1,64 @@
+package makerbot_test
+
+import (
+	"bytes"
+	"image/jpeg"
+	"testing"
+
+	makerbot "github.com/tjhorner/makerbot-rpc"
+)
+
+func TestCameraFrameYUYV(t *testing.T) {
+	// 4x2 frame: left half black, right half white, no chroma
+	data := []byte{
+		16, 128, 16, 128, 235, 128, 235, 128,
+		16, 128, 16, 128, 235, 128, 235, 128,
+	}
+
+	frame := makerbot.CameraFrame{
+		Data:     data,
+		Metadata: &makerbot.CameraFrameMetadata{FileSize: uint32(len(data)), Width: 4, Height: 2, Format: makerbot.CameraFrameFormatYUYV},
+	}
+
+	img, err := frame.Image()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if img.Bounds().Dx() != 4 || img.Bounds().Dy() != 2 {
+		t.Errorf("image size is wrong; wanted: 4x2, got: %dx%d\n", img.Bounds().Dx(), img.Bounds().Dy())
+	}
+
+	if r, _, _, _ := img.At(0, 0).RGBA(); r>>8 > 5 {
+		t.Errorf("left pixel should be black; got red value %d\n", r>>8)
+	}
+
+	if r, _, _, _ := img.At(3, 1).RGBA(); r>>8 < 250 {
+		t.Errorf("right pixel should be white; got red value %d\n", r>>8)
+	}
+
+	enc, err := frame.JPEG(makerbot.FrameEncodeOptions{Width: 2, Quality: 90})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := jpeg.DecodeConfig(bytes.NewReader(enc))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.Width != 2 || cfg.Height != 1 {
+		t.Errorf("resized JPEG size is wrong; wanted: 2x1, got: %dx%d\n", cfg.Width, cfg.Height)
+	}
+}
+
+func TestCameraFrameYUYVTooShort(t *testing.T) {
+	frame := makerbot.CameraFrame{
+		Data:     make([]byte, 4),
+		Metadata: &makerbot.CameraFrameMetadata{Width: 4, Height: 2, Format: makerbot.CameraFrameFormatYUYV},
+	}
+
+	if _, err := frame.Image(); err == nil {
+		t.Error("expected an error for a truncated frame")
+	}
+}
@@ -1,8 +1,15 @@
 module github.com/tjhorner/makerbot-rpc
 
-go 1.12
+go 1.17
 
 require (
 	github.com/google/uuid v1.1.2
 	github.com/hashicorp/mdns v1.0.1
 )
+
+require (
+	github.com/miekg/dns v1.0.14 // indirect
+	golang.org/x/crypto v0.0.0-20181029021203-45a5f77698d3 // indirect
+	golang.org/x/net v0.0.0-20181023162649-9b4f9f5ad519 // indirect
+	golang.org/x/sys v0.0.0-20181026203630-95b1ffbd15a5 // indirect
+)
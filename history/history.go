@@ -0,0 +1,139 @@
+// Package history records the outcome of every print job a MakerBot
+// printer runs.
+package history
+
+import (
+	"sync"
+	"time"
+
+	makerbot "github.com/tjhorner/makerbot-rpc"
+)
+
+// Outcome is how a print job ended
+type Outcome string
+
+const (
+	// OutcomeCompleted means the print finished successfully
+	OutcomeCompleted Outcome = "completed"
+	// OutcomeFailed means the print failed (out of filament, jammed, etc.)
+	OutcomeFailed Outcome = "failed"
+	// OutcomeCancelled means someone cancelled the print
+	OutcomeCancelled Outcome = "cancelled"
+)
+
+// Record is everything we know about a print job once it has ended
+type Record struct {
+	PrinterSerial    string             `json:"printer_serial"`
+	PrinterName      string             `json:"printer_name"`
+	ProcessID        int                `json:"process_id"`
+	Username         string             `json:"username"`
+	Filename         string             `json:"filename"`
+	StartTime        time.Time          `json:"start_time"`
+	EndTime          time.Time          `json:"end_time"`
+	Elapsed          time.Duration      `json:"elapsed"`
+	FilamentExtruded float32            `json:"filament_extruded"`
+	Temperatures     map[string]float32 `json:"temperatures,omitempty"`
+	Outcome          Outcome            `json:"outcome"`
+	Reason           string             `json:"reason,omitempty"`
+}
+
+// Recorder watches printers' state and writes a Record to its
+// Store every time a print job completes, fails or is cancelled.
+type Recorder struct {
+	store    Store
+	errCb    *func(error)
+	recorded map[string]int // printer serial -> last recorded process ID
+	mux      sync.Mutex
+}
+
+// NewRecorder creates a Recorder that writes to `store`
+func NewRecorder(store Store) *Recorder {
+	return &Recorder{
+		store:    store,
+		recorded: make(map[string]int),
+	}
+}
+
+// HandleError calls `cb` when a Record could not be written
+// to the Store.
+func (r *Recorder) HandleError(cb func(error)) {
+	r.errCb = &cb
+}
+
+// Attach starts recording print jobs from `c`. The client must
+// already be connected so its Printer is known.
+func (r *Recorder) Attach(c *makerbot.Client) {
+	c.HandleStateChange(r.StateHandler(c.Printer))
+}
+
+// StateHandler returns a function suitable for Client.HandleStateChange
+// that records print jobs from `printer`. Use Attach unless you are
+// feeding states in from somewhere else (e.g. a recording).
+func (r *Recorder) StateHandler(printer *makerbot.Printer) func(old, new *makerbot.PrinterMetadata) {
+	return func(old, new *makerbot.PrinterMetadata) {
+		var proc *makerbot.PrinterProcess
+
+		if new != nil && new.CurrentProcess != nil && new.CurrentProcess.Finished() {
+			proc = new.CurrentProcess
+		} else if old != nil && old.CurrentProcess != nil && (new == nil || new.CurrentProcess == nil || new.CurrentProcess.ID != old.CurrentProcess.ID) {
+			// The process went away before we saw it end
+			proc = old.CurrentProcess
+		}
+
+		if proc == nil || proc.Filename == nil {
+			return
+		}
+
+		r.mux.Lock()
+		if id, ok := r.recorded[printer.Serial]; ok && id == proc.ID {
+			r.mux.Unlock()
+			return
+		}
+		r.recorded[printer.Serial] = proc.ID
+		r.mux.Unlock()
+
+		err := r.store.Append(newRecord(printer, proc))
+		if err != nil && r.errCb != nil {
+			(*r.errCb)(err)
+		}
+	}
+}
+
+func outcome(proc *makerbot.PrinterProcess) Outcome {
+	switch {
+	case proc.Cancelled:
+		return OutcomeCancelled
+	case proc.Step == makerbot.StepFailed || proc.Step == makerbot.StepError || proc.Reason != nil:
+		return OutcomeFailed
+	case proc.Complete || proc.Step == makerbot.StepCompleted:
+		return OutcomeCompleted
+	}
+
+	// It disappeared without finishing
+	return OutcomeFailed
+}
+
+func newRecord(printer *makerbot.Printer, proc *makerbot.PrinterProcess) Record {
+	rec := Record{
+		PrinterSerial:    printer.Serial,
+		PrinterName:      printer.MachineName,
+		ProcessID:        proc.ID,
+		Filename:         *proc.Filename,
+		StartTime:        proc.Started(),
+		EndTime:          time.Now(),
+		Elapsed:          proc.Elapsed(),
+		FilamentExtruded: proc.FilamentExtruded,
+		Temperatures:     proc.PrintTemperatures,
+		Outcome:          outcome(proc),
+	}
+
+	if proc.Username != nil {
+		rec.Username = *proc.Username
+	}
+
+	if proc.Reason != nil {
+		rec.Reason = *proc.Reason
+	}
+
+	return rec
+}
@@ -0,0 +1,134 @@
+package history_test
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	makerbot "github.com/tjhorner/makerbot-rpc"
+	"github.com/tjhorner/makerbot-rpc/history"
+)
+
+var printer = &makerbot.Printer{Serial: "23C100000000", MachineName: "Bessie"}
+
+func state(t *testing.T, process string) *makerbot.PrinterMetadata {
+	var m makerbot.PrinterMetadata
+	err := json.Unmarshal([]byte(`{"current_process": `+process+`}`), &m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &m
+}
+
+func TestRecorder(t *testing.T) {
+	store := &history.MemoryStore{}
+	handle := history.NewRecorder(store).StateHandler(printer)
+
+	printing := state(t, `{"id": 1, "filename": "box.makerbot", "username": "tj", "step": "printing", "start_time": 1556000000000}`)
+	completed := state(t, `{"id": 1, "filename": "box.makerbot", "username": "tj", "step": "completed", "complete": true, "filament_extruded": 120.5}`)
+	failing := state(t, `{"id": 2, "filename": "cube.makerbot", "username": "bob", "step": "printing"}`)
+	failed := state(t, `{"id": 2, "filename": "cube.makerbot", "username": "bob", "step": "failed", "reason": "filament_slip"}`)
+	loading := state(t, `{"id": 3, "step": "loading_filament", "complete": true}`)
+
+	handle(nil, printing)
+	handle(printing, completed)
+	handle(completed, completed) // should not be recorded twice
+	handle(completed, failing)
+	handle(failing, failed)
+	handle(failed, state(t, `null`))
+	handle(nil, loading) // not a print job
+
+	recs, _ := store.Records()
+	if len(recs) != 2 {
+		t.Fatalf("wrong number of records; wanted: 2, got: %d\n", len(recs))
+	}
+
+	if recs[0].Outcome != history.OutcomeCompleted || recs[0].Username != "tj" || recs[0].FilamentExtruded != 120.5 {
+		t.Errorf("first record is wrong; got: %+v\n", recs[0])
+	}
+
+	if recs[1].Outcome != history.OutcomeFailed || recs[1].Reason != "filament_slip" {
+		t.Errorf("second record is wrong; got: %+v\n", recs[1])
+	}
+}
+
+func TestJSONLinesStoreAndQuery(t *testing.T) {
+	dir, err := ioutil.TempDir("", "history")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store := history.NewJSONLinesStore(filepath.Join(dir, "history.jsonl"))
+
+	store.Append(history.Record{PrinterSerial: "a", Username: "tj", Outcome: history.OutcomeCompleted})
+	store.Append(history.Record{PrinterSerial: "b", Username: "tj", Outcome: history.OutcomeCancelled})
+	store.Append(history.Record{PrinterSerial: "a", Username: "bob", Outcome: history.OutcomeFailed})
+
+	recs, err := history.Find(store, history.Query{Username: "tj"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(recs) != 2 {
+		t.Errorf("wrong number of records for user; wanted: 2, got: %d\n", len(recs))
+	}
+
+	recs, _ = history.Find(store, history.Query{PrinterSerial: "a", Outcome: history.OutcomeFailed})
+	if len(recs) != 1 || recs[0].Username != "bob" {
+		t.Errorf("wrong records for printer and outcome; got: %+v\n", recs)
+	}
+
+	var buf bytes.Buffer
+	err = history.WriteCSV(&buf, recs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if lines := strings.Count(buf.String(), "\n"); lines != 2 {
+		t.Errorf("wrong number of CSV lines; wanted: 2, got: %d\n", lines)
+	}
+}
+
+func TestWriteCSVTemperatures(t *testing.T) {
+	recs := []history.Record{
+		{PrinterSerial: "a", Temperatures: map[string]float32{"extruder": 215.5}},
+		{PrinterSerial: "b"},
+		{PrinterSerial: "c", Temperatures: map[string]float32{"extruder": 210, "chamber": 40}},
+	}
+
+	var buf bytes.Buffer
+	err := history.WriteCSV(&buf, recs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rows) != 4 {
+		t.Fatalf("wrong number of CSV rows; wanted: 4, got: %d\n", len(rows))
+	}
+
+	header := rows[0]
+	n := len(header)
+	if header[n-2] != "temperature_chamber" || header[n-1] != "temperature_extruder" {
+		t.Errorf("wrong temperature columns; got: %v\n", header[n-2:])
+	}
+
+	wants := [][2]string{{"", "215.5"}, {"", ""}, {"40", "210"}}
+	for i, want := range wants {
+		row := rows[i+1]
+		if len(row) != n || row[n-2] != want[0] || row[n-1] != want[1] {
+			t.Errorf("wrong temperatures for %s; wanted: %v, got: %v\n", row[0], want, row[n-2:])
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package history
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Query selects Records. Zero-valued fields match everything.
+type Query struct {
+	PrinterSerial string    // Only records from this printer
+	Username      string    // Only records started by this user
+	Since         time.Time // Only records that ended at or after this time
+	Until         time.Time // Only records that ended before this time
+	Outcome       Outcome   // Only records with this outcome
+}
+
+// Matches reports whether `rec` is selected by the query
+func (q Query) Matches(rec Record) bool {
+	if q.PrinterSerial != "" && rec.PrinterSerial != q.PrinterSerial {
+		return false
+	}
+
+	if q.Username != "" && rec.Username != q.Username {
+		return false
+	}
+
+	if !q.Since.IsZero() && rec.EndTime.Before(q.Since) {
+		return false
+	}
+
+	if !q.Until.IsZero() && !rec.EndTime.Before(q.Until) {
+		return false
+	}
+
+	if q.Outcome != "" && rec.Outcome != q.Outcome {
+		return false
+	}
+
+	return true
+}
+
+// Find returns every Record in `store` that matches `q`
+func Find(store Store, q Query) ([]Record, error) {
+	recs, err := store.Records()
+	if err != nil {
+		return nil, err
+	}
+
+	var found []Record
+	for _, rec := range recs {
+		if q.Matches(rec) {
+			found = append(found, rec)
+		}
+	}
+
+	return found, nil
+}
+
+var csvHeader = []string{
+	"printer_serial",
+	"printer_name",
+	"process_id",
+	"username",
+	"filename",
+	"start_time",
+	"end_time",
+	"elapsed_seconds",
+	"filament_extruded",
+	"outcome",
+	"reason",
+}
+
+// WriteCSV writes `recs` to `w` as CSV, with a header row. Temperatures
+// get a `temperature_<name>` column for every name any of the records
+// has, in alphabetical order; records without one leave it empty.
+func WriteCSV(w io.Writer, recs []Record) error {
+	cw := csv.NewWriter(w)
+
+	var temps []string
+	seen := make(map[string]bool)
+	for _, rec := range recs {
+		for name := range rec.Temperatures {
+			if !seen[name] {
+				seen[name] = true
+				temps = append(temps, name)
+			}
+		}
+	}
+
+	sort.Strings(temps)
+
+	header := append([]string{}, csvHeader...)
+	for _, name := range temps {
+		header = append(header, "temperature_"+name)
+	}
+
+	err := cw.Write(header)
+	if err != nil {
+		return err
+	}
+
+	for _, rec := range recs {
+		row := []string{
+			rec.PrinterSerial,
+			rec.PrinterName,
+			strconv.Itoa(rec.ProcessID),
+			rec.Username,
+			rec.Filename,
+			rec.StartTime.Format(time.RFC3339),
+			rec.EndTime.Format(time.RFC3339),
+			strconv.FormatFloat(rec.Elapsed.Seconds(), 'f', 0, 64),
+			strconv.FormatFloat(float64(rec.FilamentExtruded), 'f', -1, 32),
+			string(rec.Outcome),
+			rec.Reason,
+		}
+
+		for _, name := range temps {
+			temp, ok := rec.Temperatures[name]
+			if !ok {
+				row = append(row, "")
+				continue
+			}
+
+			row = append(row, strconv.FormatFloat(float64(temp), 'f', -1, 32))
+		}
+
+		err = cw.Write(row)
+		if err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteJSON writes `recs` to `w` as a JSON array
+func WriteJSON(w io.Writer, recs []Record) error {
+	if recs == nil {
+		recs = []Record{}
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(recs)
+}
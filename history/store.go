@@ -0,0 +1,109 @@
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"sync"
+)
+
+// Store persists Records
+type Store interface {
+	// Append adds a Record to the store
+	Append(rec Record) error
+	// Records returns every Record in the store, oldest first
+	Records() ([]Record, error)
+}
+
+// JSONLinesStore is a Store that writes one JSON-encoded Record
+// per line to a file.
+type JSONLinesStore struct {
+	Path string
+	mux  sync.Mutex
+}
+
+// NewJSONLinesStore creates a JSONLinesStore that writes to the
+// file at `path`. The file is created if it does not exist.
+func NewJSONLinesStore(path string) *JSONLinesStore {
+	return &JSONLinesStore{Path: path}
+}
+
+// Append adds a Record to the end of the file
+func (s *JSONLinesStore) Append(rec Record) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	f, err := os.OpenFile(s.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(append(b, '\n'))
+	return err
+}
+
+// Records reads every Record from the file. A missing file
+// is treated as an empty history.
+func (s *JSONLinesStore) Records() ([]Record, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	f, err := os.Open(s.Path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var recs []Record
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var rec Record
+		err = json.Unmarshal(scanner.Bytes(), &rec)
+		if err != nil {
+			return nil, err
+		}
+
+		recs = append(recs, rec)
+	}
+
+	return recs, scanner.Err()
+}
+
+// MemoryStore is a Store that keeps Records in memory
+type MemoryStore struct {
+	recs []Record
+	mux  sync.Mutex
+}
+
+// Append adds a Record to the store
+func (s *MemoryStore) Append(rec Record) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	s.recs = append(s.recs, rec)
+	return nil
+}
+
+// Records returns a copy of every Record in the store
+func (s *MemoryStore) Records() ([]Record, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	return append([]Record(nil), s.recs...), nil
+}
@@ -1,6 +1,7 @@
 package jsonrpc
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -55,8 +56,9 @@ type Client struct {
 	jr      JSONReader
 	errCb   *func(error)
 	conn    *net.TCPConn
-	mux     sync.Mutex
-	rMux    sync.Mutex
+	closed  chan struct{} // closed once the connection is lost
+	mux     sync.Mutex    // protects conn, closed and errCb, and serializes writes
+	rMux    sync.Mutex    // protects rsps and subs
 }
 
 func (c *Client) logVerbose(format string, a ...interface{}) {
@@ -69,20 +71,23 @@ func (c *Client) logVerbose(format string, a ...interface{}) {
 
 // Connect connects to the remote JSON-RPC server
 func (c *Client) Connect() error {
-	c.logVerbose("resolving TCP address %s:%s", c.IP, c.Port)
+	return c.ConnectContext(context.Background())
+}
 
-	addr, err := net.ResolveTCPAddr("tcp", c.IP+":"+c.Port)
-	if err != nil {
-		return err
-	}
+// ConnectContext is like Connect, but gives up dialing when `ctx` is done
+func (c *Client) ConnectContext(ctx context.Context) error {
+	hostport := net.JoinHostPort(c.IP, c.Port)
 
-	c.logVerbose("dialing resolved tcp address %s", addr.String())
+	c.logVerbose("dialing %s", hostport)
 
-	conn, err := net.DialTCP("tcp", nil, addr)
+	var d net.Dialer
+	nc, err := d.DialContext(ctx, "tcp", hostport)
 	if err != nil {
 		return err
 	}
 
+	conn := nc.(*net.TCPConn)
+
 	c.logVerbose("TCP connection: %+v", *conn)
 
 	conn.SetKeepAlive(true)
@@ -110,16 +115,22 @@ func (c *Client) Connect() error {
 			var req rpcServerRequest
 			json.Unmarshal(j, &req)
 
-			if sub, ok := c.subs[req.Method]; ok {
+			c.rMux.Lock()
+			sub, ok := c.subs[req.Method]
+			c.rMux.Unlock()
+
+			if ok {
 				go sub(req.Params)
 			}
 		} else if resp.ID != nil {
 			// Response
-			if rsp, ok := c.rsps[*resp.ID]; ok {
+			c.rMux.Lock()
+			rsp, ok := c.rsps[*resp.ID]
+			delete(c.rsps, *resp.ID)
+			c.rMux.Unlock()
+
+			if ok {
 				go func() { rsp <- resp }()
-				c.rMux.Lock()
-				delete(c.rsps, *resp.ID)
-				c.rMux.Unlock()
 			}
 		}
 
@@ -127,6 +138,12 @@ func (c *Client) Connect() error {
 	}
 
 	c.jr = NewJSONReader(done)
+	closed := make(chan struct{})
+
+	c.mux.Lock()
+	c.closed = closed
+	c.conn = conn
+	c.mux.Unlock()
 
 	go func() {
 		// temporary array to pipe from the TCP connection to the
@@ -138,11 +155,19 @@ func (c *Client) Connect() error {
 			_, err := conn.Read(b)
 
 			if err != nil {
-				c.conn.Close()
-				c.conn = nil
+				conn.Close()
 
-				if c.errCb != nil {
-					(*c.errCb)(err)
+				c.mux.Lock()
+				if c.conn == conn {
+					c.conn = nil
+				}
+				errCb := c.errCb
+				c.mux.Unlock()
+
+				close(closed)
+
+				if errCb != nil {
+					(*errCb)(err)
 				}
 				break
 			}
@@ -151,35 +176,34 @@ func (c *Client) Connect() error {
 		}
 	}()
 
-	c.conn = conn
-
 	return nil
 }
 
 // HandleReadError calls `cb` when an error occurs while
 // reading from the underlying TCP socket
 func (c *Client) HandleReadError(cb func(error)) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
 	c.errCb = &cb
 }
 
 // Close closes the underlying TCP connection
 func (c *Client) Close() error {
-	if c.conn == nil {
+	c.mux.Lock()
+	conn := c.conn
+	c.mux.Unlock()
+
+	if conn == nil {
 		return nil
 	}
 
 	c.jr.Reset()
-	return (*c.conn).Close()
+	return conn.Close()
 }
 
 // Call calls the remote JSON-RPC server with `serviceMethod`
 func (c *Client) Call(serviceMethod string, args, reply interface{}) error {
-	if c.conn == nil {
-		return errors.New("Client is not connected (hint: call Connect())")
-	}
-
-	conn := *c.conn
-
 	if args == nil {
 		args = rpcEmptyParams{}
 	}
@@ -201,9 +225,15 @@ func (c *Client) Call(serviceMethod string, args, reply interface{}) error {
 
 	c.mux.Lock()
 
+	conn, closed := c.conn, c.closed
+	if conn == nil {
+		c.mux.Unlock()
+		return errors.New("Client is not connected (hint: call Connect())")
+	}
+
 	var msg chan rpcResponse
 	if reply != nil {
-		msg = make(chan rpcResponse)
+		msg = make(chan rpcResponse, 1)
 
 		c.rMux.Lock()
 		c.rsps[id] = msg
@@ -214,7 +244,16 @@ func (c *Client) Call(serviceMethod string, args, reply interface{}) error {
 	c.mux.Unlock()
 
 	if reply != nil {
-		resp := <-msg
+		var resp rpcResponse
+		select {
+		case resp = <-msg:
+		case <-closed:
+			c.rMux.Lock()
+			delete(c.rsps, id)
+			c.rMux.Unlock()
+
+			return errors.New("connection closed while waiting for a response")
+		}
 
 		if resp.Error != nil {
 			return resp.Error
@@ -236,11 +275,18 @@ func (c *Client) Call(serviceMethod string, args, reply interface{}) error {
 // be called with the raw JSON the server sent in the `Params`. From there, you
 // should unmarshal it yourself.
 func (c *Client) Subscribe(namespace string, cb func(message json.RawMessage)) error {
+	c.mux.Lock()
+	connected := c.conn != nil
+	c.mux.Unlock()
+
+	c.rMux.Lock()
+	defer c.rMux.Unlock()
+
 	if _, ok := c.subs[namespace]; ok {
 		return errors.New("already subscribed to " + namespace)
 	}
 
-	if c.conn == nil {
+	if !connected {
 		return errors.New("Client is not connected (hint: call Connect())")
 	}
 
@@ -252,6 +298,9 @@ func (c *Client) Subscribe(namespace string, cb func(message json.RawMessage)) e
 // channel. It is safe to call this method even if there is nothing subscribed
 // to the channel.
 func (c *Client) Unsubscribe(namespace string) {
+	c.rMux.Lock()
+	defer c.rMux.Unlock()
+
 	delete(c.subs, namespace)
 }
 
@@ -267,5 +316,9 @@ func (c *Client) Write(bs []byte) (int, error) {
 	c.mux.Lock()
 	defer c.mux.Unlock()
 
+	if c.conn == nil {
+		return 0, errors.New("Client is not connected (hint: call Connect())")
+	}
+
 	return c.conn.Write(bs)
 }
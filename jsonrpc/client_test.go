@@ -0,0 +1,51 @@
+package jsonrpc_test
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/tjhorner/makerbot-rpc/jsonrpc"
+)
+
+func TestCallConnectionClosed(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	// Hang up as soon as a request comes in
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+
+		conn.Read(make([]byte, 512))
+		conn.Close()
+	}()
+
+	host, port, _ := net.SplitHostPort(l.Addr().String())
+
+	c := jsonrpc.NewClient(host, port)
+	err = c.Connect()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := make(chan error, 1)
+	go func() {
+		var reply bool
+		result <- c.Call("ping", nil, &reply)
+	}()
+
+	select {
+	case err = <-result:
+		if err == nil {
+			t.Error("call on a closed connection didn't fail")
+		}
+	case <-time.After(2 * time.Second):
+		t.Error("call is still waiting after the connection was closed")
+	}
+}
@@ -115,6 +115,9 @@ func (r *JSONReader) transition(b byte) {
 
 // Reset resets
 func (r *JSONReader) Reset() {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
 	r.reset()
 }
 
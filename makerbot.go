@@ -4,8 +4,11 @@
 package makerbot
 
 import (
+	"net"
+	"reflect"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/hashicorp/mdns"
@@ -29,40 +32,59 @@ const mdnsService = "_makerbot-jsonrpc._tcp"
 // DiscoverPrinters will discover printers that are on your current
 // LAN network and return them once `timeout` is up.
 //
+// Printers are searched for with both mDNS and MakerBot's UDP broadcast
+// probe (see DiscoverPrintersBroadcast), and printers found by both are
+// only returned once. An error is only returned if both methods fail.
+//
 // Note that all fields are not returned in the printer's mDNS TXT
 // reply. Useful fields like MachineName and IP/Port are in there,
 // though, so that should be enough to initiate a connection with
 // the printer.
+//
+// To keep watching the network for printers, see Discoverer.
 func DiscoverPrinters(timeout time.Duration) (*[]Printer, error) {
+	var (
+		mdnsPrinters, bcastPrinters *[]Printer
+		mdnsErr, bcastErr           error
+		wg                          sync.WaitGroup
+	)
+
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		mdnsPrinters, mdnsErr = discoverMDNS(timeout)
+	}()
+	go func() {
+		defer wg.Done()
+		bcastPrinters, bcastErr = DiscoverPrintersBroadcast(timeout)
+	}()
+	wg.Wait()
+
+	if mdnsErr != nil && bcastErr != nil {
+		return nil, mdnsErr
+	}
+
+	printers := mergePrinters(mdnsPrinters, bcastPrinters)
+	return &printers, nil
+}
+
+func discoverMDNS(timeout time.Duration) (*[]Printer, error) {
 	var printers []Printer
+	seen := make(map[string]bool)
 
 	ch := make(chan *mdns.ServiceEntry)
+	done := make(chan struct{})
 	go func() {
+		defer close(done)
+
 		for entry := range ch {
-			if !strings.Contains(entry.Name, "_makerbot-jsonrpc") {
+			printer, ok := printerFromEntry(entry)
+			if !ok || seen[printerKey(printer)] {
 				continue
 			}
 
-			fields := *parseInfoFields(&entry.InfoFields)
-
-			vid, _ := strconv.Atoi(fields["vid"])
-			pid, _ := strconv.Atoi(fields["pid"])
-
-			printer := Printer{
-				MachineName:        fields["machine_name"],
-				MachineType:        fields["machine_type"],
-				APIVersion:         fields["api_version"],
-				Serial:             fields["iserial"],
-				MotorDriverVersion: fields["motor_driver_version"],
-				Vid:                vid,
-				Pid:                pid,
-				SSLPort:            fields["ssl_port"],
-				BotType:            fields["bot_type"],
-				IP:                 entry.AddrV4.String(),
-				Port:               string(entry.Port),
-			}
-
-			printers = append(printers, printer)
+			seen[printerKey(printer)] = true
+			printers = append(printers, *printer)
 		}
 	}()
 
@@ -71,11 +93,100 @@ func DiscoverPrinters(timeout time.Duration) (*[]Printer, error) {
 	params.Entries = ch
 
 	err := mdns.Query(params)
+	close(ch)
+	<-done
+
 	if err != nil {
 		return nil, err
 	}
 
-	close(ch)
-
 	return &printers, nil
 }
+
+// mergePrinters combines lists of printers, de-duplicating them by
+// printerKey. When a printer is in several lists, fields missing from
+// the first occurrence are filled in from the later ones.
+func mergePrinters(lists ...*[]Printer) []Printer {
+	var merged []Printer
+	index := make(map[string]int)
+
+	for _, list := range lists {
+		if list == nil {
+			continue
+		}
+
+		for _, p := range *list {
+			key := printerKey(&p)
+
+			i, ok := index[key]
+			if !ok {
+				index[key] = len(merged)
+				merged = append(merged, p)
+				continue
+			}
+
+			fillPrinter(&merged[i], &p)
+		}
+	}
+
+	return merged
+}
+
+// fillPrinter sets the zero-valued fields of `dst` to the
+// values from `src`.
+func fillPrinter(dst, src *Printer) {
+	d := reflect.ValueOf(dst).Elem()
+	s := reflect.ValueOf(src).Elem()
+
+	for i := 0; i < d.NumField(); i++ {
+		f := d.Field(i)
+		if reflect.DeepEqual(f.Interface(), reflect.Zero(f.Type()).Interface()) {
+			f.Set(s.Field(i))
+		}
+	}
+}
+
+func printerFromEntry(entry *mdns.ServiceEntry) (*Printer, bool) {
+	if !strings.Contains(entry.Name, "_makerbot-jsonrpc") {
+		return nil, false
+	}
+
+	fields := parseInfoFields(entry.InfoFields)
+
+	vid, _ := strconv.Atoi(fields["vid"])
+	pid, _ := strconv.Atoi(fields["pid"])
+
+	printer := &Printer{
+		MachineName:        fields["machine_name"],
+		MachineType:        fields["machine_type"],
+		APIVersion:         fields["api_version"],
+		Serial:             fields["iserial"],
+		MotorDriverVersion: fields["motor_driver_version"],
+		Vid:                vid,
+		Pid:                pid,
+		SSLPort:            fields["ssl_port"],
+		BotType:            fields["bot_type"],
+		Port:               strconv.Itoa(entry.Port),
+	}
+
+	switch {
+	case entry.AddrV4 != nil:
+		printer.IP = entry.AddrV4.String()
+	case entry.AddrV6 != nil:
+		printer.IP = entry.AddrV6.String()
+	default:
+		return nil, false
+	}
+
+	return printer, true
+}
+
+// printerKey identifies a printer across discovery replies. Printers
+// are identified by serial, or by address if they don't report one.
+func printerKey(p *Printer) string {
+	if p.Serial != "" {
+		return p.Serial
+	}
+
+	return net.JoinHostPort(p.IP, p.Port)
+}
@@ -0,0 +1,277 @@
+package printfile
+
+import (
+	"io"
+	"math"
+)
+
+// zEpsilon is how close two Z heights have to be to be the same layer
+const zEpsilon = 1e-6
+
+// MotionStats sums up the moves of a toolpath or of one of its layers
+type MotionStats struct {
+	Moves             int     // Number of move commands
+	ExtrusionLength   float64 // Net length of filament fed, in mm (from the A axis; retractions count negatively)
+	ExtrusionDistance float64 // Distance travelled by the nozzle while extruding, in mm
+	TravelDistance    float64 // Distance travelled by the nozzle while not extruding, in mm
+	DurationSeconds   float64 // Time the moves take at their FeedRate, ignoring acceleration
+}
+
+func (s *MotionStats) add(o MotionStats) {
+	s.Moves += o.Moves
+	s.ExtrusionLength += o.ExtrusionLength
+	s.ExtrusionDistance += o.ExtrusionDistance
+	s.TravelDistance += o.TravelDistance
+	s.DurationSeconds += o.DurationSeconds
+}
+
+// LayerStats is the MotionStats of one layer. A layer starts at the
+// first extruding move at a new Z height; moves that lead up to it
+// (e.g. travelling to the start of the layer) are counted with it.
+type LayerStats struct {
+	Index int     // Index of the layer, from 0
+	Z     float64 // Z height the layer is extruded at
+	MotionStats
+}
+
+// ToolpathStats is the result of AnalyzeToolpath
+type ToolpathStats struct {
+	Commands int          // Number of instructions, of any function
+	Layers   []LayerStats // Every layer, from the bottom up
+	Totals   MotionStats  // Sum of all layers
+}
+
+// ZHeights returns the Z height of every layer, from the bottom up
+func (s *ToolpathStats) ZHeights() []float64 {
+	zs := make([]float64, len(s.Layers))
+	for i, l := range s.Layers {
+		zs[i] = l.Z
+	}
+
+	return zs
+}
+
+// MetadataDelta is a value from the Metadata next to the same value
+// computed from the toolpath
+type MetadataDelta struct {
+	Metadata float64
+	Toolpath float64
+}
+
+// Ratio returns Toolpath / Metadata, or NaN if Metadata is zero
+func (d MetadataDelta) Ratio() float64 {
+	if d.Metadata == 0 {
+		return math.NaN()
+	}
+
+	return d.Toolpath / d.Metadata
+}
+
+// Within reports whether Toolpath is within `tolerance` (a fraction,
+// e.g. 0.05 for 5%) of Metadata
+func (d MetadataDelta) Within(tolerance float64) bool {
+	return math.Abs(d.Toolpath-d.Metadata) <= math.Abs(d.Metadata)*tolerance
+}
+
+// MetadataComparison compares ToolpathStats with the Metadata of the
+// same file. Big differences usually mean the slice is broken (e.g. a
+// truncated toolpath).
+type MetadataComparison struct {
+	ExtrusionDistanceMm MetadataDelta // Metadata.ExtrusionDistanceMm vs. Totals.ExtrusionLength
+	DurationSeconds     MetadataDelta // Metadata.DurationSeconds vs. Totals.DurationSeconds
+	NumZLayers          MetadataDelta // Metadata.NumZLayers vs. len(Layers)
+}
+
+// Compare compares the stats with `m`.
+//
+// Note that the toolpath's duration ignores acceleration and heating,
+// so it is expected to come in under Metadata.DurationSeconds (it is
+// usually closer to Metadata.CommandedDurationSeconds).
+func (s *ToolpathStats) Compare(m *Metadata) MetadataComparison {
+	return MetadataComparison{
+		ExtrusionDistanceMm: MetadataDelta{m.ExtrusionDistanceMm, s.Totals.ExtrusionLength},
+		DurationSeconds:     MetadataDelta{m.DurationSeconds, s.Totals.DurationSeconds},
+		NumZLayers:          MetadataDelta{float64(m.NumZLayers), float64(len(s.Layers))},
+	}
+}
+
+// AnalyzeFileToolpath streams the toolpath of a .makerbot file given a
+// filepath through AnalyzeToolpath
+func AnalyzeFileToolpath(filename string) (*ToolpathStats, error) {
+	tr, err := OpenFileToolpath(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer tr.Close()
+
+	return AnalyzeToolpath(tr)
+}
+
+// AnalyzeToolpath walks a toolpath and computes its ToolpathStats. Pass
+// a ToolpathReader to analyze big toolpaths without loading them into
+// memory, or Toolpath.Iterator() for one that is already loaded.
+func AnalyzeToolpath(it ToolpathIterator) (*ToolpathStats, error) {
+	stats := &ToolpathStats{}
+
+	commands, err := walkSegments(it, func(seg *segment) {
+		var ms *MotionStats
+		if seg.layer < 0 {
+			ms = &stats.Totals // A toolpath that never extrudes has no layers
+		} else {
+			if seg.layer == len(stats.Layers) {
+				stats.Layers = append(stats.Layers, LayerStats{Index: seg.layer, Z: seg.layerZ})
+			}
+
+			ms = &stats.Layers[seg.layer].MotionStats
+		}
+
+		ms.Moves++
+		ms.ExtrusionLength += seg.da
+		ms.DurationSeconds += seg.duration
+
+		if seg.extruding() {
+			ms.ExtrusionDistance += seg.distance
+		} else {
+			ms.TravelDistance += seg.distance
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	stats.Commands = commands
+
+	for _, l := range stats.Layers {
+		stats.Totals.add(l.MotionStats)
+	}
+
+	return stats, nil
+}
+
+// segment is a move along a toolpath, along with the layer it belongs to
+type segment struct {
+	from, to position
+	motion
+	tags   []string
+	layer  int     // -1 if the toolpath never extrudes
+	layerZ float64 // Z height of the layer
+}
+
+// walkSegments calls `cb` with every move of a toolpath, in order, and
+// returns the number of instructions. A layer starts at the first
+// extruding move at a new Z height, and the moves that lead up to it
+// belong to it, so they are held back until that move (or the end of
+// the toolpath) is reached.
+func walkSegments(it ToolpathIterator, cb func(*segment)) (int, error) {
+	var (
+		pos      position
+		pending  []segment
+		commands int
+		layer    = -1
+		layerZ   float64
+	)
+
+	flush := func() {
+		for i := range pending {
+			pending[i].layer = layer
+			pending[i].layerZ = layerZ
+			cb(&pending[i])
+		}
+
+		pending = pending[:0]
+	}
+
+	for {
+		inst, err := it.Next()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return commands, err
+		}
+
+		commands++
+
+		cmd := &inst.Command
+		if cmd.Function != "move" {
+			continue
+		}
+
+		from := pos
+		m := pos.move(cmd)
+		pending = append(pending, segment{from: from, to: pos, motion: m, tags: cmd.Tags})
+
+		if !m.extruding() {
+			continue
+		}
+
+		if layer < 0 || math.Abs(pos.z-layerZ) > zEpsilon {
+			layer++
+			layerZ = pos.z
+		}
+
+		flush()
+	}
+
+	flush()
+
+	return commands, nil
+}
+
+// position tracks where the nozzle and filament are along a toolpath
+type position struct {
+	x, y, z, a float64
+	known      bool // whether x, y and z are known (they aren't before the first move)
+}
+
+type motion struct {
+	distance float64 // XYZ distance
+	da       float64 // Change of A
+	duration float64
+}
+
+func (m motion) extruding() bool {
+	return m.da > 0 && m.distance > 0
+}
+
+// move applies `cmd` and returns the motion it made
+func (p *position) move(cmd *ToolpathCommand) motion {
+	rel := cmd.Metadata.Relative
+	params := cmd.Parameters
+
+	next := *p
+	next.x = axis(p.x, params.X, rel.X)
+	next.y = axis(p.y, params.Y, rel.Y)
+	next.z = axis(p.z, params.Z, rel.Z)
+	next.a = axis(p.a, params.A, rel.A)
+	next.known = true
+
+	var m motion
+	m.da = next.a - p.a
+
+	// Where the nozzle was before the first move is unknown, so it
+	// doesn't count as moving
+	if p.known {
+		m.distance = math.Sqrt(sq(next.x-p.x) + sq(next.y-p.y) + sq(next.z-p.z))
+	}
+
+	if params.FeedRate > 0 {
+		m.duration = math.Max(m.distance, math.Abs(m.da)) / params.FeedRate
+	}
+
+	*p = next
+	return m
+}
+
+func axis(current, param float64, relative bool) float64 {
+	if relative {
+		return current + param
+	}
+
+	return param
+}
+
+func sq(v float64) float64 {
+	return v * v
+}
@@ -0,0 +1,128 @@
+package printfile_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/tjhorner/makerbot-rpc/printfile"
+)
+
+const (
+	// The toolpath has 56 "Layer Section" comments, even though
+	// meta.json says num_z_layers is 57
+	expectedLayers = 56
+	expectedMoves  = 8260
+)
+
+func TestAnalyzeFileToolpath(t *testing.T) {
+	stats, err := printfile.AnalyzeFileToolpath(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	meta, err := printfile.GetFileMetadata(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stats.Commands != expectedToolpathCommands || stats.Totals.Moves != expectedMoves {
+		t.Errorf("got %d commands and %d moves, wanted %d and %d", stats.Commands, stats.Totals.Moves, expectedToolpathCommands, expectedMoves)
+	}
+
+	if len(stats.Layers) != expectedLayers {
+		t.Errorf("got %d layers, wanted %d", len(stats.Layers), expectedLayers)
+	}
+
+	zs := stats.ZHeights()
+	if zs[0] != meta.BoundingBox.ZMin || zs[len(zs)-1] != meta.BoundingBox.ZMax {
+		t.Errorf("layers go from %f to %f, wanted %f to %f", zs[0], zs[len(zs)-1], meta.BoundingBox.ZMin, meta.BoundingBox.ZMax)
+	}
+
+	cmp := stats.Compare(meta)
+	if !cmp.ExtrusionDistanceMm.Within(1e-9) {
+		t.Errorf("extrusion length is %f, metadata says %f", cmp.ExtrusionDistanceMm.Toolpath, cmp.ExtrusionDistanceMm.Metadata)
+	}
+
+	if d := (printfile.MetadataDelta{meta.CommandedDurationSeconds, stats.Totals.DurationSeconds}); !d.Within(0.05) {
+		t.Errorf("duration is %f, metadata says %f was commanded", d.Toolpath, d.Metadata)
+	}
+
+	if cmp.DurationSeconds.Ratio() >= 1 {
+		t.Errorf("duration is %f, which should be under the metadata's %f", cmp.DurationSeconds.Toolpath, cmp.DurationSeconds.Metadata)
+	}
+
+	var sum printfile.MotionStats
+	for _, l := range stats.Layers {
+		sum.ExtrusionLength += l.ExtrusionLength
+		sum.Moves += l.Moves
+	}
+
+	if sum.Moves != stats.Totals.Moves || math.Abs(sum.ExtrusionLength-stats.Totals.ExtrusionLength) > 1e-9 {
+		t.Errorf("layers don't add up to the totals: %+v vs. %+v", sum, stats.Totals)
+	}
+}
+
+func move(x, y, z, a, feedrate float64, relative bool) printfile.ToolpathInstruction {
+	var inst printfile.ToolpathInstruction
+	inst.Command.Function = "move"
+	inst.Command.Parameters.X = x
+	inst.Command.Parameters.Y = y
+	inst.Command.Parameters.Z = z
+	inst.Command.Parameters.A = a
+	inst.Command.Parameters.FeedRate = feedrate
+	inst.Command.Metadata.Relative.X = relative
+	inst.Command.Metadata.Relative.Y = relative
+	inst.Command.Metadata.Relative.Z = relative
+	inst.Command.Metadata.Relative.A = relative
+	return inst
+}
+
+func TestAnalyzeToolpath(t *testing.T) {
+	var comment printfile.ToolpathInstruction
+	comment.Command.Function = "comment"
+
+	tp := printfile.Toolpath{
+		move(0, 0, 0.2, 0, 10, false),  // start position
+		move(10, 0, 0.2, 1, 10, false), // layer 0: extrude 10mm
+		move(0, 0, 0.2, -0.5, 1, true), // retract and hop up
+		move(0, 5, 0, 0, 5, true),      // travel 5mm at the new Z
+		move(0, 0, 0, 0.5, 1, true),    // restart
+		comment,                        //
+		move(10, 0, 0, 1, 10, true),    // layer 1: extrude 10mm
+		move(0, 0, 1, 0, 1, true),      // hop without extruding
+		move(0, 0, -1, 0, 1, true),     // and back down
+		move(0, -5, 0, 0.5, 10, true),  // still layer 1
+	}
+
+	stats, err := printfile.AnalyzeToolpath(tp.Iterator())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stats.Commands != 10 || stats.Totals.Moves != 9 {
+		t.Errorf("got %d commands and %d moves", stats.Commands, stats.Totals.Moves)
+	}
+
+	if len(stats.Layers) != 2 {
+		t.Fatalf("got layers %v, wanted 2 layers", stats.ZHeights())
+	}
+
+	l0, l1 := stats.Layers[0], stats.Layers[1]
+
+	if l0.Z != 0.2 || l0.Moves != 2 || l0.ExtrusionLength != 1 || l0.ExtrusionDistance != 10 || l0.TravelDistance != 0 {
+		t.Errorf("unexpected layer 0: %+v", l0)
+	}
+
+	if math.Abs(l1.Z-0.4) > 1e-9 || l1.Moves != 7 || l1.ExtrusionLength != 1.5 || l1.ExtrusionDistance != 15 {
+		t.Errorf("unexpected layer 1: %+v", l1)
+	}
+
+	if travel := 0.2 + 5 + 2; math.Abs(l1.TravelDistance-travel) > 1e-9 {
+		t.Errorf("layer 1 travelled %f, wanted %f", l1.TravelDistance, travel)
+	}
+
+	// 1s + (0.5s retract + 1s travel + 0.5s restart + 1s) + (1s + 1s + 0.5s)
+	if math.Abs(stats.Totals.DurationSeconds-6.5) > 1e-9 {
+		t.Errorf("got duration %f, wanted 6.5", stats.Totals.DurationSeconds)
+	}
+}
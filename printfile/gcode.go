@@ -0,0 +1,247 @@
+package printfile
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// GCodeOptions configures ExportGCode
+type GCodeOptions struct {
+	// Metadata, if set, is summed up in comments at the top of the G-code
+	Metadata *Metadata
+}
+
+// gcodeWriter keeps track of the state of the machine the G-code is
+// written for, so that only what changes is written
+type gcodeWriter struct {
+	w           *bufio.Writer
+	pos         position
+	feedRate    float64
+	relative    int // -1 if unknown, 0 for G90, 1 for G91
+	relativeE   int // -1 if unknown, 0 for M82, 1 for M83
+	fanOn       map[int]bool
+	fanDuty     map[int]float64
+	temperature map[int]float64
+}
+
+// ExportFileGCode writes the toolpath of a .makerbot file given a
+// filepath to `w` as G-code, with its metadata in a header
+func ExportFileGCode(filename string, w io.Writer) error {
+	meta, err := GetFileMetadata(filename)
+	if err != nil {
+		return err
+	}
+
+	tr, err := OpenFileToolpath(filename)
+	if err != nil {
+		return err
+	}
+	defer tr.Close()
+
+	return ExportGCode(w, tr, GCodeOptions{Metadata: meta})
+}
+
+// ExportGCode writes a toolpath to `w` as RepRap/Marlin-flavored G-code:
+//
+//   - moves become G0 (if the filament doesn't move) or G1, with feed
+//     rates converted to mm/min and the A axis as E
+//   - relative flags become G90/G91 and M82/M83. Moves with some of X, Y
+//     and Z relative and others absolute can't be expressed in G-code, so
+//     they are written as absolute moves.
+//   - fan functions become M106/M107, temperatures M104/M109, delays G4
+//   - comments and tags become comments
+//
+// Functions that have no G-code equivalent are written as comments.
+func ExportGCode(w io.Writer, it ToolpathIterator, opts GCodeOptions) error {
+	g := &gcodeWriter{
+		w:           bufio.NewWriter(w),
+		relative:    -1,
+		relativeE:   -1,
+		fanOn:       make(map[int]bool),
+		fanDuty:     make(map[int]float64),
+		temperature: make(map[int]float64),
+	}
+
+	if opts.Metadata != nil {
+		g.header(opts.Metadata)
+	}
+
+	for {
+		inst, err := it.Next()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return err
+		}
+
+		g.command(&inst.Command)
+	}
+
+	return g.w.Flush()
+}
+
+func (g *gcodeWriter) header(m *Metadata) {
+	fmt.Fprintf(g.w, "; Exported from a .makerbot file\n")
+	fmt.Fprintf(g.w, "; bot_type: %s\n", m.BotType)
+	fmt.Fprintf(g.w, "; uuid: %s\n", m.UUID)
+	fmt.Fprintf(g.w, "; extruder_temperatures: %v\n", m.ExtruderTemperatures)
+	fmt.Fprintf(g.w, "; platform_temperature: %d\n", m.PlatformTemperature)
+	fmt.Fprintf(g.w, "; duration_s: %s\n", num(m.DurationSeconds, 1))
+	fmt.Fprintf(g.w, "; extrusion_distance_mm: %s\n", num(m.ExtrusionDistanceMm, 2))
+	fmt.Fprintf(g.w, "; num_z_layers: %d\n", m.NumZLayers)
+}
+
+// num formats `v` with at most `prec` decimals
+func num(v float64, prec int) string {
+	s := strconv.FormatFloat(v, 'f', prec, 64)
+	if strings.Contains(s, ".") {
+		s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	}
+
+	if s == "-0" {
+		s = "0"
+	}
+
+	return s
+}
+
+// line writes a line of G-code, followed by `tags` as a comment
+func (g *gcodeWriter) line(code string, tags []string) {
+	g.w.WriteString(code)
+
+	if len(tags) > 0 {
+		g.w.WriteString(" ; ")
+		g.w.WriteString(strings.Join(tags, ", "))
+	}
+
+	g.w.WriteByte('\n')
+}
+
+func (g *gcodeWriter) command(cmd *ToolpathCommand) {
+	p := &cmd.Parameters
+
+	switch cmd.Function {
+	case "move":
+		g.move(cmd)
+	case "comment":
+		g.line("; "+strings.Replace(p.Comment, "\n", " ", -1), cmd.Tags)
+	case "fan_duty":
+		duty, _ := p.Value.(float64)
+		g.fanDuty[p.Index] = duty
+
+		if g.fanOn[p.Index] {
+			g.fan(p.Index, cmd.Tags)
+		}
+	case "toggle_fan":
+		on, _ := p.Value.(bool)
+		g.fanOn[p.Index] = on
+
+		if on {
+			g.fan(p.Index, cmd.Tags)
+		} else {
+			g.line(fmt.Sprintf("M107 P%d", p.Index), cmd.Tags)
+		}
+	case "set_toolhead_temperature":
+		g.temperature[p.Index] = p.Temperature
+		g.line(fmt.Sprintf("M104 T%d S%s", p.Index, num(p.Temperature, 1)), cmd.Tags)
+	case "wait_for_temperature":
+		if t, ok := g.temperature[p.Index]; ok {
+			g.line(fmt.Sprintf("M109 T%d S%s", p.Index, num(t, 1)), cmd.Tags)
+		} else {
+			g.line("M116", cmd.Tags)
+		}
+	case "delay":
+		g.line(fmt.Sprintf("G4 P%d", int(math.Round(p.Seconds*1000))), cmd.Tags)
+	default:
+		params, _ := p.marshal(cmd.Function)
+		g.line(fmt.Sprintf("; %s %s", cmd.Function, params), cmd.Tags)
+	}
+}
+
+func (g *gcodeWriter) fan(index int, tags []string) {
+	duty, ok := g.fanDuty[index]
+	if !ok {
+		duty = 1
+	}
+
+	g.line(fmt.Sprintf("M106 P%d S%d", index, int(math.Round(math.Max(0, math.Min(1, duty))*255))), tags)
+}
+
+func (g *gcodeWriter) move(cmd *ToolpathCommand) {
+	rel := cmd.Metadata.Relative
+	p := &cmd.Parameters
+
+	from := g.pos
+	g.pos.move(cmd)
+
+	// G91 only if all of X, Y and Z are relative; otherwise the tracked
+	// position is written as an absolute move
+	relative := 0
+	if rel.X && rel.Y && rel.Z && from.known {
+		relative = 1
+	}
+
+	relativeE := 0
+	if rel.A {
+		relativeE = 1
+	}
+
+	if relative != g.relative {
+		g.relative = relative
+		g.line([]string{"G90", "G91"}[relative], nil)
+
+		// G90/G91 set the extruder's mode too in Marlin
+		g.relativeE = -1
+	}
+
+	if relativeE != g.relativeE {
+		g.relativeE = relativeE
+		g.line([]string{"M82", "M83"}[relativeE], nil)
+	}
+
+	// Before the first move, where the nozzle is is unknown, so every
+	// axis is written
+	known := from.known
+
+	var words []string
+	axis := func(name string, from, to, param float64, prec int) {
+		switch {
+		case relative == 1 && param != 0:
+			words = append(words, name+num(param, prec))
+		case relative == 0 && (!known || num(to, prec) != num(from, prec)):
+			words = append(words, name+num(to, prec))
+		}
+	}
+
+	axis("X", from.x, g.pos.x, p.X, 3)
+	axis("Y", from.y, g.pos.y, p.Y, 3)
+	axis("Z", from.z, g.pos.z, p.Z, 3)
+
+	code := "G0"
+	if g.pos.a != from.a {
+		code = "G1"
+
+		if relativeE == 1 {
+			words = append(words, "E"+num(g.pos.a-from.a, 5))
+		} else {
+			words = append(words, "E"+num(g.pos.a, 5))
+		}
+	}
+
+	if p.FeedRate > 0 && p.FeedRate != g.feedRate {
+		g.feedRate = p.FeedRate
+		words = append(words, "F"+num(p.FeedRate*60, 1))
+	}
+
+	if len(words) == 0 {
+		return
+	}
+
+	g.line(code+" "+strings.Join(words, " "), cmd.Tags)
+}
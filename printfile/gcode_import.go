@@ -0,0 +1,757 @@
+package printfile
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// Profile describes the MakerBot printer G-code is imported for
+type Profile struct {
+	BotType          string  // Codename of the printer, which Client.PrintFileVerify checks (e.g. "replicator_b")
+	ToolType         string  // Codename of the extruder (e.g. "mk13")
+	Material         string  // e.g. "pla"
+	BuildVolume      Volume  // Size of the build volume in mm; X and Y are centered on 0
+	MaxFeedRate      float64 // Faster X/Y moves are slowed down to this, in mm/s
+	MaxZFeedRate     float64 // Faster Z-only moves are slowed down to this, in mm/s
+	MinTemperature   int     // Extruder temperatures below this (other than 0, off) are refused
+	MaxTemperature   int     // Extruder temperatures above this are refused
+	HeatedPlatform   bool    // Whether platform temperatures are allowed
+	FilamentDiameter float64 // Used to estimate the mass of the print, in mm
+	FilamentDensity  float64 // Used to estimate the mass of the print, in g/cm³
+
+	// Template is the metadata the imported file's metadata is based on,
+	// e.g. the metadata of a file MakerBot Print sliced for the same
+	// printer. The fields that describe the print are replaced; the rest,
+	// like the machine_config and extruder profiles the printer reads,
+	// can't be made up, so it is required.
+	Template *Metadata
+}
+
+// Volume is the size of a build volume, in mm
+type Volume struct {
+	X, Y, Z float64
+}
+
+// ReplicatorPlus is the Profile of the MakerBot Replicator+ with a
+// Smart Extruder+ and PLA. Its Template has to be set before importing.
+var ReplicatorPlus = Profile{
+	BotType:          "replicator_b",
+	ToolType:         "mk13",
+	Material:         "pla",
+	BuildVolume:      Volume{295, 195, 165},
+	MaxFeedRate:      270,
+	MaxZFeedRate:     30,
+	MinTemperature:   180,
+	MaxTemperature:   240,
+	FilamentDiameter: 1.77,
+	FilamentDensity:  1.25,
+}
+
+// GCodeError is returned when G-code can't be mapped to a toolpath
+// safely
+type GCodeError struct {
+	Line   int    // Line number, from 1
+	Text   string // The line
+	Reason string
+}
+
+func (e *GCodeError) Error() string {
+	return fmt.Sprintf("G-code line %d (%s): %s", e.Line, e.Text, e.Reason)
+}
+
+// gcodeTypes maps the feature type comments slicers write (e.g.
+// `;TYPE:WALL-OUTER` from Cura or `;TYPE:External perimeter` from
+// PrusaSlicer) to toolpath tags
+var gcodeTypes = map[string]string{
+	"wall-outer":                 "Inset",
+	"wall-inner":                 "Inset",
+	"perimeter":                  "Inset",
+	"external perimeter":         "Inset",
+	"overhang perimeter":         "Inset",
+	"fill":                       "Infill",
+	"skin":                       "Infill",
+	"internal infill":            "Infill",
+	"solid infill":               "Infill",
+	"top solid infill":           "Infill",
+	"bridge infill":              "Infill",
+	"gap fill":                   "Infill",
+	"support":                    "Support",
+	"support-interface":          "Support",
+	"support material":           "Support",
+	"support material interface": "Support",
+	"skirt":                      "Purge",
+	"skirt/brim":                 "Purge",
+	"raft":                       "Raft",
+}
+
+// gcodeIgnored are codes that don't affect what is printed (or that the
+// printer takes care of by itself), so they are dropped
+var gcodeIgnored = map[string]bool{
+	"G4": true, "G21": true, "M18": true, "M73": true, "M75": true, "M76": true, "M77": true, "M84": true,
+	"M105": true, "M110": true, "M114": true, "M115": true, "M117": true, "M118": true,
+	"M201": true, "M203": true, "M204": true, "M205": true, "M900": true, "M907": true, "T0": true,
+}
+
+// gcodeRefused are codes that can't be mapped safely, and why
+var gcodeRefused = map[string]string{
+	"G2":   "arcs are not supported",
+	"G3":   "arcs are not supported",
+	"G10":  "firmware retraction is not supported",
+	"G11":  "firmware retraction is not supported",
+	"G20":  "inches are not supported",
+	"M0":   "pausing is not supported",
+	"M1":   "pausing is not supported",
+	"M25":  "pausing is not supported",
+	"M600": "filament changes are not supported",
+}
+
+type bbox struct {
+	min, max [3]float64
+	empty    bool
+}
+
+func newBBox() bbox {
+	return bbox{empty: true}
+}
+
+func (b *bbox) add(x, y, z float64) {
+	p := [3]float64{x, y, z}
+	for i := range p {
+		if b.empty || p[i] < b.min[i] {
+			b.min[i] = p[i]
+		}
+
+		if b.empty || p[i] > b.max[i] {
+			b.max[i] = p[i]
+		}
+	}
+
+	b.empty = false
+}
+
+// GCodeReader reads RepRap/Marlin-flavored G-code as a toolpath for a
+// Profile. It refuses (with a *GCodeError) G-code that it can't map
+// safely, like arcs, tool changes, temperatures the profile doesn't
+// allow, or extruding outside of the build volume.
+//
+// Temperatures are not part of toolpaths; MakerBot printers heat up
+// with the temperatures in the metadata before printing. They are
+// collected in ExtruderTemperature and PlatformTemperature, and the
+// temperature can't change during the print.
+type GCodeReader struct {
+	ExtruderTemperature int // Extruder temperature set by the G-code, once it was read
+	PlatformTemperature int // Platform temperature set by the G-code, once it was read
+
+	s       *bufio.Scanner
+	profile Profile
+	line    int
+	queue   []ToolpathInstruction
+
+	offsetX, offsetY float64 // added to X and Y
+	checkXY          bool    // whether to check X and Y of extruding moves against the build volume as they are read
+
+	relative, relativeE bool
+	x, y, z, e          float64 // position in G-code coordinates
+	a                   float64 // absolute filament position
+	feedRate            float64
+	placed              bool // whether X and Y have a position; they start at the center of the build plate
+	moved               bool
+	fanOn               bool
+	tag                 string
+
+	extrusion bbox // extent of extruding moves, in toolpath coordinates
+}
+
+// NewGCodeReader creates a GCodeReader that reads G-code from `r` for
+// printer `p`
+func NewGCodeReader(r io.Reader, p Profile) *GCodeReader {
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	return &GCodeReader{
+		s:         s,
+		profile:   p,
+		checkXY:   true,
+		extrusion: newBBox(),
+	}
+}
+
+// Next implements ToolpathIterator
+func (g *GCodeReader) Next() (*ToolpathInstruction, error) {
+	for len(g.queue) == 0 {
+		if !g.s.Scan() {
+			if err := g.s.Err(); err != nil {
+				return nil, err
+			}
+
+			return nil, io.EOF
+		}
+
+		g.line++
+
+		err := g.parseLine(g.s.Text())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	inst := g.queue[0]
+	g.queue = g.queue[1:]
+	return &inst, nil
+}
+
+// ReadAll reads the rest of the G-code into a Toolpath
+func (g *GCodeReader) ReadAll() (Toolpath, error) {
+	tp := Toolpath{}
+	for {
+		inst, err := g.Next()
+		if err == io.EOF {
+			return tp, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		tp = append(tp, *inst)
+	}
+}
+
+func (g *GCodeReader) refuse(text, format string, a ...interface{}) error {
+	return &GCodeError{Line: g.line, Text: strings.TrimSpace(text), Reason: fmt.Sprintf(format, a...)}
+}
+
+func (g *GCodeReader) emit(function string, tags []string, set func(p *ToolpathParameters)) {
+	var inst ToolpathInstruction
+	inst.Command.Function = function
+	inst.Command.Tags = tags
+	set(&inst.Command.Parameters)
+	g.queue = append(g.queue, inst)
+}
+
+func (g *GCodeReader) parseLine(text string) error {
+	code, comment := text, ""
+	if i := strings.IndexByte(text, ';'); i >= 0 {
+		code, comment = text[:i], strings.TrimSpace(text[i+1:])
+	}
+
+	// Checksums
+	if i := strings.IndexByte(code, '*'); i >= 0 {
+		code = code[:i]
+	}
+
+	code = strings.TrimSpace(code)
+
+	if code == "" {
+		if strings.HasPrefix(strings.ToUpper(comment), "TYPE:") {
+			g.tag = gcodeTypes[strings.ToLower(strings.TrimSpace(comment[5:]))]
+		}
+
+		if comment != "" {
+			g.emit("comment", nil, func(p *ToolpathParameters) { p.Comment = comment })
+		}
+
+		return nil
+	}
+
+	word, rest, err := parseGCodeWord(code)
+
+	// Line numbers
+	if err == nil && word.letter == 'N' {
+		if strings.TrimSpace(rest) == "" {
+			return nil
+		}
+
+		word, rest, err = parseGCodeWord(rest)
+	}
+
+	if err != nil {
+		return g.refuse(text, "%s", err)
+	}
+
+	cmd := word.String()
+	if reason, ok := gcodeRefused[cmd]; ok {
+		return g.refuse(text, "%s", reason)
+	}
+
+	// The arguments of ignored codes aren't read, since some are text
+	// (like the message of M117)
+	if gcodeIgnored[cmd] {
+		return nil
+	}
+
+	words, err := parseGCodeWords(rest)
+	if err != nil {
+		return g.refuse(text, "%s", err)
+	}
+
+	args := make(map[byte]float64)
+	for _, w := range words {
+		args[w.letter] = w.value
+	}
+
+	switch cmd {
+	case "G0", "G1":
+		return g.move(text, args)
+	case "G28", "G29":
+		// The printer homes (and levels) by itself before printing
+		if g.moved {
+			return g.refuse(text, "homing during the print is not supported")
+		}
+	case "G90":
+		g.relative, g.relativeE = false, false
+	case "G91":
+		g.relative, g.relativeE = true, true
+	case "M82":
+		g.relativeE = false
+	case "M83":
+		g.relativeE = true
+	case "G92":
+		for _, axis := range []byte{'X', 'Y', 'Z'} {
+			if _, ok := args[axis]; ok {
+				return g.refuse(text, "setting the position of %c is not supported", axis)
+			}
+		}
+
+		if e, ok := args['E']; ok {
+			g.e = e
+		}
+	case "M104", "M109":
+		return g.extruderTemperature(text, args)
+	case "M140", "M190":
+		s := int(temperatureArg(args))
+		if s > 0 && !g.profile.HeatedPlatform {
+			return g.refuse(text, "%s has no heated platform", g.profile.BotType)
+		}
+
+		if s > 0 {
+			g.PlatformTemperature = s
+		}
+	case "M106":
+		if args['P'] != 0 {
+			return g.refuse(text, "only fan 0 is supported")
+		}
+
+		s, ok := args['S']
+		if !ok {
+			s = 255
+		}
+
+		g.emit("fan_duty", nil, func(p *ToolpathParameters) { p.Value = math.Max(0, math.Min(1, s/255)) })
+		if !g.fanOn {
+			g.fanOn = true
+			g.emit("toggle_fan", nil, func(p *ToolpathParameters) { p.Value = true })
+		}
+	case "M107":
+		if g.fanOn {
+			g.fanOn = false
+			g.emit("toggle_fan", nil, func(p *ToolpathParameters) { p.Value = false })
+		}
+	case "M220", "M221":
+		if s, ok := args['S']; ok && s != 100 {
+			return g.refuse(text, "speed and flow overrides are not supported")
+		}
+	default:
+		if strings.HasPrefix(cmd, "T") {
+			return g.refuse(text, "only one extruder is supported")
+		}
+
+		return g.refuse(text, "unknown command %s", cmd)
+	}
+
+	return nil
+}
+
+func (g *GCodeReader) extruderTemperature(text string, args map[byte]float64) error {
+	if args['T'] != 0 {
+		return g.refuse(text, "only one extruder is supported")
+	}
+
+	s := int(math.Round(temperatureArg(args)))
+	if s == 0 {
+		// Turning the heater off at the end; the printer does it anyway
+		return nil
+	}
+
+	if s < g.profile.MinTemperature {
+		return g.refuse(text, "%d°C is below the minimum of %d°C", s, g.profile.MinTemperature)
+	}
+
+	if s > g.profile.MaxTemperature {
+		return g.refuse(text, "%d°C is above the maximum of %d°C", s, g.profile.MaxTemperature)
+	}
+
+	if g.moved && g.ExtruderTemperature != 0 && s != g.ExtruderTemperature {
+		return g.refuse(text, "changing the temperature during the print is not supported")
+	}
+
+	g.ExtruderTemperature = s
+	return nil
+}
+
+// temperatureArg returns the target temperature of M104, M109, M140 or
+// M190, which is S or, for "wait until heated or cooled", R
+func temperatureArg(args map[byte]float64) float64 {
+	if s, ok := args['S']; ok {
+		return s
+	}
+
+	return args['R']
+}
+
+func (g *GCodeReader) move(text string, args map[byte]float64) error {
+	if !g.placed {
+		g.x, g.y = -g.offsetX, -g.offsetY
+		g.placed = true
+	}
+
+	x, y, z, e := g.x, g.y, g.z, g.e
+
+	set := func(axis byte, v *float64, relative bool) {
+		if arg, ok := args[axis]; ok {
+			if relative {
+				*v += arg
+			} else {
+				*v = arg
+			}
+		}
+	}
+
+	set('X', &x, g.relative)
+	set('Y', &y, g.relative)
+	set('Z', &z, g.relative)
+	set('E', &e, g.relativeE)
+
+	if f, ok := args['F']; ok {
+		if f <= 0 {
+			return g.refuse(text, "feed rate must be positive")
+		}
+
+		g.feedRate = f / 60
+	}
+
+	if g.feedRate == 0 {
+		return g.refuse(text, "move without a feed rate")
+	}
+
+	da := e - g.e
+	dxy := math.Hypot(x-g.x, y-g.y)
+	dz := math.Abs(z - g.z)
+
+	feedRate := g.feedRate
+	if dxy > 0 && feedRate > g.profile.MaxFeedRate {
+		feedRate = g.profile.MaxFeedRate
+	} else if dxy == 0 && dz > 0 && feedRate > g.profile.MaxZFeedRate {
+		feedRate = g.profile.MaxZFeedRate
+	}
+
+	tx, ty := x+g.offsetX, y+g.offsetY
+
+	if z < 0 || z > g.profile.BuildVolume.Z {
+		return g.refuse(text, "Z %g is outside of the build volume", z)
+	}
+
+	var tags []string
+	switch {
+	case da > 0 && (dxy > 0 || dz > 0):
+		// Only the print has to fit on the build plate; MakerBot Print's
+		// own toolpaths travel to the corner of the printer's reach,
+		// which is a little outside of it
+		if g.checkXY && (math.Abs(tx) > g.profile.BuildVolume.X/2 || math.Abs(ty) > g.profile.BuildVolume.Y/2) {
+			return g.refuse(text, "X %g Y %g is outside of the build volume", tx, ty)
+		}
+
+		if g.tag != "" {
+			tags = []string{g.tag}
+		}
+
+		g.extrusion.add(tx, ty, z)
+	case da > 0:
+		tags = []string{"Restart"}
+	case da < 0 && dxy == 0 && dz == 0:
+		tags = []string{"Retract"}
+	default:
+		tags = []string{"Travel Move"}
+	}
+
+	g.x, g.y, g.z, g.e = x, y, z, e
+	g.a += da
+	g.moved = true
+
+	a := g.a
+	g.emit("move", tags, func(p *ToolpathParameters) {
+		p.X, p.Y, p.Z, p.A, p.FeedRate = tx, ty, z, a, feedRate
+	})
+
+	return nil
+}
+
+type gcodeWord struct {
+	letter byte
+	value  float64
+	raw    string
+}
+
+func (w gcodeWord) String() string {
+	return string(w.letter) + w.raw
+}
+
+// parseGCodeWords splits a line of G-code (without its comment) into
+// words, like "G1 X10.5 Y-3" or "G1X10.5Y-3"
+func parseGCodeWords(code string) ([]gcodeWord, error) {
+	var words []gcodeWord
+
+	for strings.TrimSpace(code) != "" {
+		w, rest, err := parseGCodeWord(code)
+		if err != nil {
+			return nil, err
+		}
+
+		words = append(words, w)
+		code = rest
+	}
+
+	return words, nil
+}
+
+// parseGCodeWord reads the first word of `code`, and returns it and the
+// rest of `code`
+func parseGCodeWord(code string) (gcodeWord, string, error) {
+	code = strings.TrimLeft(code, " \t")
+	if code == "" {
+		return gcodeWord{}, "", errors.New("missing word")
+	}
+
+	c := code[0]
+	if c >= 'a' && c <= 'z' {
+		c -= 'a' - 'A'
+	}
+
+	if c < 'A' || c > 'Z' {
+		return gcodeWord{}, "", fmt.Errorf("unexpected %q", code[0])
+	}
+
+	j := 1
+	for j < len(code) && strings.IndexByte("+-.0123456789", code[j]) >= 0 {
+		j++
+	}
+
+	raw := code[1:j]
+	value, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return gcodeWord{}, "", fmt.Errorf("%c has no valid number", c)
+	}
+
+	// Normalize "G01" to "G1"
+	if c == 'G' || c == 'M' || c == 'T' {
+		raw = strconv.FormatFloat(value, 'f', -1, 64)
+	}
+
+	return gcodeWord{c, value, raw}, code[j:], nil
+}
+
+// ImportOptions configures ImportGCode
+type ImportOptions struct {
+	Profile    Profile     // Printer to import for (e.g. ReplicatorPlus)
+	Recenter   bool        // Move the print to the center of the build plate (for G-code sliced with the origin in a corner)
+	Thumbnails []Thumbnail // Thumbnails to include; if nil, they are rendered from the toolpath
+}
+
+// thumbnailSizes are the thumbnails MakerBot Print includes
+var thumbnailSizes = [][2]int{{55, 40}, {110, 80}, {320, 200}}
+
+// ImportGCodeFile converts the G-code file `src` to the .makerbot file
+// `dst` with ImportGCode
+func ImportGCodeFile(src, dst string, opts ImportOptions) (*Metadata, error) {
+	f, err := os.Open(src)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var meta *Metadata
+	err = writeFileAtomic(dst, func(w io.Writer) error {
+		meta, err = ImportGCode(f, w, opts)
+		return err
+	})
+
+	return meta, err
+}
+
+// ImportGCode converts G-code read from `r` to a .makerbot file for
+// opts.Profile, written to `w`, and returns its metadata. The metadata
+// (bounding box, extrusion distance, duration, etc.) is computed from
+// the moves, the same way AnalyzeToolpath does. `r` is read twice: once
+// to check and measure the G-code, and once to write the toolpath.
+//
+// opts.Profile needs a Template for the same BotType. G-code that can't
+// be mapped safely is refused with a *GCodeError, and nothing useful is
+// written to `w`.
+func ImportGCode(r io.ReadSeeker, w io.Writer, opts ImportOptions) (*Metadata, error) {
+	p := opts.Profile
+	if p.BotType == "" {
+		return nil, errors.New("ImportGCode: profile has no BotType")
+	}
+
+	if p.Template == nil {
+		return nil, errors.New("ImportGCode: profile has no Template")
+	}
+
+	if p.Template.BotType != p.BotType {
+		return nil, fmt.Errorf("ImportGCode: Template is for %s, not %s", p.Template.BotType, p.BotType)
+	}
+
+	// First pass: check everything, and measure the print
+	gr := NewGCodeReader(r, p)
+	gr.checkXY = !opts.Recenter
+
+	stats, err := AnalyzeToolpath(gr)
+	if err != nil {
+		return nil, err
+	}
+
+	if gr.extrusion.empty {
+		return nil, errors.New("ImportGCode: G-code doesn't extrude anything")
+	}
+
+	if gr.ExtruderTemperature == 0 {
+		return nil, errors.New("ImportGCode: G-code doesn't set an extruder temperature (M104 or M109)")
+	}
+
+	var offsetX, offsetY float64
+	if opts.Recenter {
+		offsetX = -(gr.extrusion.min[0] + gr.extrusion.max[0]) / 2
+		offsetY = -(gr.extrusion.min[1] + gr.extrusion.max[1]) / 2
+	}
+
+	meta := importMetadata(p, gr, stats, offsetX, offsetY)
+
+	// Second pass: write it, checking moves against the build volume now
+	// that we know where the print ends up
+	_, err = r.Seek(0, io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+
+	gr = NewGCodeReader(r, p)
+	gr.offsetX, gr.offsetY = offsetX, offsetY
+
+	out := NewWriter(w)
+
+	_, err = out.WriteToolpath(gr)
+	if err != nil {
+		return nil, err
+	}
+
+	err = out.WriteMetadata(meta)
+	if err != nil {
+		return nil, err
+	}
+
+	thumbnails := opts.Thumbnails
+	if thumbnails == nil {
+		_, err = r.Seek(0, io.SeekStart)
+		if err != nil {
+			return nil, err
+		}
+
+		gr = NewGCodeReader(r, p)
+		gr.offsetX, gr.offsetY = offsetX, offsetY
+
+		thumbnails, err = renderThumbnails(gr)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, t := range thumbnails {
+		err = out.WriteThumbnail(t)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return meta, out.Close()
+}
+
+func importMetadata(p Profile, gr *GCodeReader, stats *ToolpathStats, offsetX, offsetY float64) *Metadata {
+	m := *p.Template
+	m.BotType = p.BotType
+	m.ToolType = p.ToolType
+	m.ToolTypes = []string{p.ToolType}
+
+	if p.Material != "" {
+		m.Material = p.Material
+		m.Materials = []string{p.Material}
+	}
+
+	bb := gr.extrusion
+	m.BoundingBox.XMin, m.BoundingBox.XMax = bb.min[0]+offsetX, bb.max[0]+offsetX
+	m.BoundingBox.YMin, m.BoundingBox.YMax = bb.min[1]+offsetY, bb.max[1]+offsetY
+	m.BoundingBox.ZMin, m.BoundingBox.ZMax = bb.min[2], bb.max[2]
+
+	m.ExtrusionDistanceMm = stats.Totals.ExtrusionLength
+	m.ExtrusionDistancesMm = []float64{m.ExtrusionDistanceMm}
+
+	area := math.Pi * math.Pow(p.FilamentDiameter/2, 2)
+	m.ExtrusionMassGrams = area * m.ExtrusionDistanceMm * p.FilamentDensity / 1000
+	m.ExtrusionMassesGrams = []float64{m.ExtrusionMassGrams}
+
+	// There's no acceleration model, so both are the same estimate
+	m.DurationSeconds = stats.Totals.DurationSeconds
+	m.CommandedDurationSeconds = stats.Totals.DurationSeconds
+
+	m.NumZLayers = len(stats.Layers)
+	m.NumZTransitions = 0
+	if len(stats.Layers) > 0 {
+		m.NumZTransitions = len(stats.Layers) - 1
+	}
+
+	m.TotalCommands = stats.Commands
+	m.ExtruderTemperature = gr.ExtruderTemperature
+	m.ExtruderTemperatures = []int{gr.ExtruderTemperature}
+	m.PlatformTemperature = gr.PlatformTemperature
+	m.ThingID = nil
+	m.UUID = uuid.New().String()
+
+	return &m
+}
+
+// renderThumbnails renders the whole print for every thumbnail size
+func renderThumbnails(it ToolpathIterator) ([]Thumbnail, error) {
+	r, err := RenderToolpath(it, RenderOptions{Layer: LastLayer, Cumulative: true, HideTravel: true})
+	if err != nil {
+		return nil, err
+	}
+
+	var thumbnails []Thumbnail
+	for _, size := range thumbnailSizes {
+		r.opts.Width, r.opts.Height = size[0], size[1]
+		r.fit()
+
+		var buf bytes.Buffer
+		err = r.PNG(&buf)
+		if err != nil {
+			return nil, err
+		}
+
+		thumbnails = append(thumbnails, Thumbnail{
+			Data:         buf.Bytes(),
+			TargetWidth:  size[0],
+			TargetHeight: size[1],
+			ActualWidth:  size[0],
+			ActualHeight: size[1],
+		})
+	}
+
+	return thumbnails, nil
+}
@@ -0,0 +1,340 @@
+package printfile_test
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/tjhorner/makerbot-rpc/printfile"
+)
+
+// replicatorPlus returns ReplicatorPlus with the metadata of the test
+// file as its Template
+func replicatorPlus(t *testing.T) printfile.Profile {
+	meta, err := printfile.GetFileMetadata(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	profile := printfile.ReplicatorPlus
+	profile.Template = meta
+	return profile
+}
+
+func TestImportGCodeRoundTrip(t *testing.T) {
+	dir, done := tempDir(t)
+	defer done()
+
+	orig, err := printfile.GetFileMetadata(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The toolpath has no temperatures; the printer uses the metadata's
+	var gcode bytes.Buffer
+	gcode.WriteString("M109 S215\n")
+
+	err = printfile.ExportFileGCode(file, &gcode)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	src := filepath.Join(dir, "box.gcode")
+	err = ioutil.WriteFile(src, gcode.Bytes(), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	profile := printfile.ReplicatorPlus
+	profile.Template = orig
+
+	out := filepath.Join(dir, "box.makerbot")
+	meta, err := printfile.ImportGCodeFile(src, out, printfile.ImportOptions{Profile: profile})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Client.PrintFileVerify reads the metadata back and checks the bot
+	// type against the printer's
+	parsed, err := printfile.ParseFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if parsed.Metadata.BotType != "replicator_b" || parsed.Metadata.UUID != meta.UUID {
+		t.Errorf("got bot type %q and UUID %q", parsed.Metadata.BotType, parsed.Metadata.UUID)
+	}
+
+	if meta.UUID == orig.UUID {
+		t.Error("imported file has the template's UUID")
+	}
+
+	// The printer reads these, and only the template has them
+	if !reflect.DeepEqual(parsed.Metadata.MachineConfig, orig.MachineConfig) || parsed.Metadata.MachineConfig.BotType != "replicator_b" {
+		t.Error("machine_config is different from the template's")
+	}
+
+	if meta.NumZLayers != expectedLayers || meta.ExtruderTemperature != 215 {
+		t.Errorf("got %d layers at %d°C, wanted %d at 215°C", meta.NumZLayers, meta.ExtruderTemperature, expectedLayers)
+	}
+
+	if math.Abs(meta.ExtrusionDistanceMm-orig.ExtrusionDistanceMm) > 0.01 {
+		t.Errorf("extrusion distance is %f, wanted %f", meta.ExtrusionDistanceMm, orig.ExtrusionDistanceMm)
+	}
+
+	bb, want := meta.BoundingBox, orig.BoundingBox
+	for _, d := range []float64{bb.XMin - want.XMin, bb.XMax - want.XMax, bb.YMin - want.YMin, bb.YMax - want.YMax, bb.ZMax - want.ZMax} {
+		if math.Abs(d) > 0.01 {
+			t.Errorf("got bounding box %+v, wanted %+v", bb, want)
+			break
+		}
+	}
+
+	if meta.TotalCommands != len(*parsed.Toolpath) {
+		t.Errorf("metadata says %d commands, toolpath has %d", meta.TotalCommands, len(*parsed.Toolpath))
+	}
+
+	stats, err := printfile.AnalyzeFileToolpath(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// ExportGCode drops a move that goes nowhere
+	if stats.Totals.Moves != expectedMoves-1 {
+		t.Errorf("got %d moves, wanted %d", stats.Totals.Moves, expectedMoves-1)
+	}
+
+	if math.Abs(meta.DurationSeconds-stats.Totals.DurationSeconds) > 1e-6 {
+		t.Errorf("duration is %f, toolpath takes %f", meta.DurationSeconds, stats.Totals.DurationSeconds)
+	}
+
+	if parsed.ThumbnailSizes == nil || len(*parsed.ThumbnailSizes) != 3 {
+		t.Error("thumbnails weren't rendered")
+	}
+}
+
+const square = `; sliced with the origin in the corner
+M104 S210
+G28
+G90
+M83
+G1 Z0.2 F600
+G1 X100 Y100 F6000
+;TYPE:WALL-OUTER
+G1 X120 Y100 E1 F1800
+G1 X120 Y120 E1
+G92 E0
+G1 E-0.5 F2400
+G91
+G1 X-20 E0
+G1 E0.5
+G1 Y-20 E1 F30000
+M107
+M104 S0
+`
+
+func TestGCodeReader(t *testing.T) {
+	tp, err := printfile.NewGCodeReader(strings.NewReader(square), printfile.ReplicatorPlus).ReadAll()
+	if err == nil {
+		t.Fatal("moves outside of the build volume weren't refused")
+	}
+
+	// Traveling off the plate is fine, but not extruding there
+	var gerr *printfile.GCodeError
+	if !errors.As(err, &gerr) || gerr.Line != 9 {
+		t.Fatalf("got %v, wanted an error on line 9", err)
+	}
+
+	profile := printfile.ReplicatorPlus
+	profile.BuildVolume.X, profile.BuildVolume.Y = 300, 300
+
+	gr := printfile.NewGCodeReader(strings.NewReader(square), profile)
+	tp, err = gr.ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if gr.ExtruderTemperature != 210 {
+		t.Errorf("got extruder temperature %d, wanted 210", gr.ExtruderTemperature)
+	}
+
+	type want struct {
+		x, y, z, a, feedRate float64
+		tag                  string
+	}
+
+	wants := []want{
+		{0, 0, 0.2, 0, 10, "Travel Move"},
+		{100, 100, 0.2, 0, 100, "Travel Move"},
+		{120, 100, 0.2, 1, 30, "Inset"},
+		{120, 120, 0.2, 2, 30, "Inset"},
+		{120, 120, 0.2, 1.5, 40, "Retract"},
+		{100, 120, 0.2, 1.5, 40, "Travel Move"},
+		{100, 120, 0.2, 2, 40, "Restart"},
+		{100, 100, 0.2, 3, 270, "Inset"}, // Slowed down to the profile's maximum
+	}
+
+	var got []want
+	for _, inst := range tp {
+		c := inst.Command
+		if c.Function != "move" {
+			continue
+		}
+
+		p, r := c.Parameters, c.Metadata.Relative
+		if r.X || r.Y || r.Z || r.A {
+			t.Errorf("move %d is relative", len(got))
+		}
+
+		got = append(got, want{p.X, p.Y, p.Z, p.A, p.FeedRate, strings.Join(c.Tags, ",")})
+	}
+
+	if len(got) != len(wants) {
+		t.Fatalf("got %d moves, wanted %d", len(got), len(wants))
+	}
+
+	for i := range wants {
+		g, w := got[i], wants[i]
+		if math.Abs(g.x-w.x) > 1e-9 || math.Abs(g.y-w.y) > 1e-9 || math.Abs(g.z-w.z) > 1e-9 ||
+			math.Abs(g.a-w.a) > 1e-9 || math.Abs(g.feedRate-w.feedRate) > 1e-9 || g.tag != w.tag {
+			t.Errorf("move %d is %+v, wanted %+v", i, g, w)
+		}
+	}
+}
+
+func TestGCodeReaderRelativeStart(t *testing.T) {
+	// Relative moves before any absolute X or Y start at the center
+	gcode := "M109 R215\nG91\nG1 X10 F600\nG1 X10 Y-5\nG90\nG1 Z1\n"
+
+	gr := printfile.NewGCodeReader(strings.NewReader(gcode), printfile.ReplicatorPlus)
+	tp, err := gr.ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if gr.ExtruderTemperature != 215 {
+		t.Errorf("got extruder temperature %d, wanted 215 from M109 R", gr.ExtruderTemperature)
+	}
+
+	wants := [][2]float64{{10, 0}, {20, -5}, {20, -5}}
+	if len(tp) != len(wants) {
+		t.Fatalf("got %d instructions, wanted %d", len(tp), len(wants))
+	}
+
+	for i, w := range wants {
+		p := tp[i].Command.Parameters
+		if p.X != w[0] || p.Y != w[1] {
+			t.Errorf("move %d is at X %g Y %g, wanted X %g Y %g", i, p.X, p.Y, w[0], w[1])
+		}
+	}
+}
+
+func TestGCodeReaderIgnored(t *testing.T) {
+	gcode := strings.Join([]string{
+		"M117 Printing...",
+		"N2 M117 Layer 1/3",
+		"M118 E1 Hello: 50% *12",
+		"M73 P50 R10",
+		"N5",
+	}, "\n")
+
+	tp, err := printfile.NewGCodeReader(strings.NewReader(gcode), printfile.ReplicatorPlus).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(tp) != 0 {
+		t.Errorf("got %d instructions, wanted none", len(tp))
+	}
+}
+
+func TestImportGCodeRecenter(t *testing.T) {
+	var buf bytes.Buffer
+	meta, err := printfile.ImportGCode(strings.NewReader(square), &buf, printfile.ImportOptions{
+		Profile:    replicatorPlus(t),
+		Recenter:   true,
+		Thumbnails: []printfile.Thumbnail{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bb := meta.BoundingBox
+	if bb.XMin != -10 || bb.XMax != 10 || bb.YMin != -10 || bb.YMax != 10 {
+		t.Errorf("got bounding box %+v, wanted ±10 mm", bb)
+	}
+
+	if meta.BotType != "replicator_b" || meta.ToolType != "mk13" || meta.ExtrusionDistanceMm != 3 {
+		t.Errorf("got bot type %q, tool type %q and extrusion %f", meta.BotType, meta.ToolType, meta.ExtrusionDistanceMm)
+	}
+
+	if meta.ExtrusionMassGrams <= 0 || meta.DurationSeconds <= 0 {
+		t.Errorf("got mass %f and duration %f", meta.ExtrusionMassGrams, meta.DurationSeconds)
+	}
+
+	if buf.Len() == 0 {
+		t.Error("nothing was written")
+	}
+}
+
+func TestImportGCodeRefused(t *testing.T) {
+	const start = "M104 S210\nG1 Z0.2 F600\nG1 X10 E1 F1800\n"
+
+	tests := []struct {
+		name, gcode string
+	}{
+		{"arc", start + "G2 X20 Y10 I5 J5 E1\n"},
+		{"inches", "G20\n" + start},
+		{"set position", start + "G92 X0\n"},
+		{"tool change", start + "T1\n"},
+		{"second extruder", "M104 T1 S210\n" + start},
+		{"too hot", "M104 S300\n" + start},
+		{"too cold", "M104 S50\n" + start},
+		{"too hot while cooling", "M109 R300\n" + start},
+		{"temperature change", start + "M104 S230\n"},
+		{"heated platform", "M140 S60\n" + start},
+		{"homing", start + "G28\n"},
+		{"filament change", start + "M600\n"},
+		{"flow override", start + "M221 S90\n"},
+		{"below the platform", start + "G1 Z-1\n"},
+		{"too tall", start + "G1 Z200\n"},
+		{"off the plate", start + "G1 X148 E2\n"},
+		{"unknown command", start + "M999\n"},
+		{"malformed", start + "G1 X\n"},
+		{"no feed rate", "M104 S210\nG1 X10 E1\n"},
+		{"no temperature", "G1 Z0.2 F600\nG1 X10 E1 F1800\n"},
+		{"no extrusion", "M104 S210\nG1 X10 F1800\n"},
+	}
+
+	profile := replicatorPlus(t)
+	for _, test := range tests {
+		_, err := printfile.ImportGCode(strings.NewReader(test.gcode), ioutil.Discard, printfile.ImportOptions{Profile: profile})
+		if err == nil {
+			t.Errorf("%s: wasn't refused", test.name)
+		}
+	}
+
+	_, err := printfile.ImportGCode(strings.NewReader(start), ioutil.Discard, printfile.ImportOptions{Profile: profile, Thumbnails: []printfile.Thumbnail{}})
+	if err != nil {
+		t.Errorf("import was refused: %s", err)
+	}
+
+	other := *profile.Template
+	other.BotType = "replicator_5"
+
+	for name, p := range map[string]printfile.Profile{
+		"without a profile":               {},
+		"without a template":              printfile.ReplicatorPlus,
+		"with a template for another bot": {BotType: profile.BotType, Template: &other},
+	} {
+		_, err := printfile.ImportGCode(strings.NewReader(start), ioutil.Discard, printfile.ImportOptions{Profile: p})
+		if err == nil {
+			t.Errorf("import %s wasn't refused", name)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package printfile_test
+
+import (
+	"bufio"
+	"bytes"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/tjhorner/makerbot-rpc/printfile"
+)
+
+func command(function string, tags ...string) printfile.ToolpathInstruction {
+	var inst printfile.ToolpathInstruction
+	inst.Command.Function = function
+	inst.Command.Tags = tags
+	return inst
+}
+
+func TestExportGCode(t *testing.T) {
+	comment := command("comment")
+	comment.Command.Parameters.Comment = "Layer 1"
+
+	temp := command("set_toolhead_temperature")
+	temp.Command.Parameters.Temperature = 215
+
+	duty := command("fan_duty")
+	duty.Command.Parameters.Value = 0.5
+
+	fanOn := command("toggle_fan")
+	fanOn.Command.Parameters.Value = true
+
+	fanOff := command("toggle_fan")
+	fanOff.Command.Parameters.Value = false
+
+	delay := command("delay")
+	delay.Command.Parameters.Seconds = 1.5
+
+	mixed := move(5, 0, 0.3, 0, 10, false)
+	mixed.Command.Metadata.Relative.X = true
+
+	tp := printfile.Toolpath{
+		temp,
+		command("wait_for_temperature"),
+		move(0, 0, 0.2, 0, 50, false),
+		comment,
+		tagged(move(10, 0, 0.2, 1, 10, false), "Inset"),
+		tagged(move(10, 5, 0.2, 1, 100, false), "Travel Move"),
+		duty,
+		fanOn,
+		tagged(move(-5, 0, 0, 0.5, 10, true), "Infill", "Connection"),
+		move(0, 0, 0, -1, 50, true),
+		mixed,
+		fanOff,
+		delay,
+		command("toggle_blink"),
+	}
+
+	var buf bytes.Buffer
+	err := printfile.ExportGCode(&buf, tp.Iterator(), printfile.GCodeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := strings.Join([]string{
+		"M104 T0 S215",
+		"M109 T0 S215",
+		"G90",
+		"M82",
+		"G0 X0 Y0 Z0.2 F3000",
+		"; Layer 1",
+		"G1 X10 E1 F600 ; Inset",
+		"G0 Y5 F6000 ; Travel Move",
+		"M106 P0 S128",
+		"G91",
+		"M83",
+		"G1 X-5 E0.5 F600 ; Infill, Connection",
+		"G1 E-1 F3000",
+		"G90",
+		"M82",
+		"G1 X10 Y0 Z0.3 E0 F600",
+		"M107 P0",
+		"G4 P1500",
+		"; toggle_blink {}",
+		"",
+	}, "\n")
+
+	if buf.String() != want {
+		t.Errorf("got:\n%s\nwanted:\n%s", buf.String(), want)
+	}
+}
+
+func TestExportFileGCode(t *testing.T) {
+	meta, err := printfile.GetFileMetadata(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	err = printfile.ExportFileGCode(file, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var moves int
+	var lastE float64
+
+	s := bufio.NewScanner(&buf)
+	for s.Scan() {
+		line := s.Text()
+
+		if strings.HasPrefix(line, "G0") || strings.HasPrefix(line, "G1") {
+			moves++
+		}
+
+		code := strings.SplitN(line, ";", 2)[0]
+		for _, word := range strings.Fields(code) {
+			if word[0] == 'E' {
+				lastE, _ = strconv.ParseFloat(word[1:], 64)
+			}
+		}
+
+		if strings.HasPrefix(line, "; ") && strings.Contains(line, "{") {
+			t.Errorf("function without a G-code equivalent: %s", line)
+		}
+	}
+
+	// Every move changes something, except for ones that only repeat
+	// the previous position
+	if moves < expectedMoves-10 || moves > expectedMoves {
+		t.Errorf("got %d moves, wanted about %d", moves, expectedMoves)
+	}
+
+	if d := (printfile.MetadataDelta{Metadata: meta.ExtrusionDistanceMm, Toolpath: lastE}); !d.Within(1e-6) {
+		t.Errorf("G-code extrudes up to E%f, metadata says %f", lastE, meta.ExtrusionDistanceMm)
+	}
+}
@@ -3,8 +3,10 @@ package printfile
 
 import (
 	"archive/zip"
+	"bytes"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"image/png"
 	"io/ioutil"
 	"regexp"
@@ -44,7 +46,9 @@ func GetMetadata(r *zip.ReadCloser) (*Metadata, error) {
 	return parseMetadata(r)
 }
 
-// GetToolpath grabs just the Toolpath of a .makerbot file given a zip.ReadCloser
+// GetToolpath grabs just the Toolpath of a .makerbot file given a zip.ReadCloser.
+// This loads the whole toolpath into memory; see OpenToolpath for reading
+// large ones.
 func GetToolpath(r *zip.ReadCloser) (*Toolpath, error) {
 	return parseToolpath(r)
 }
@@ -77,7 +81,9 @@ func GetFileMetadata(filename string) (*Metadata, error) {
 	return parseMetadata(rc)
 }
 
-// GetFileToolpath grabs just the Toolpath of a .makerbot file given a filepath
+// GetFileToolpath grabs just the Toolpath of a .makerbot file given a filepath.
+// This loads the whole toolpath into memory; see OpenFileToolpath for
+// reading large ones.
 func GetFileToolpath(filename string) (*Toolpath, error) {
 	rc, err := zip.OpenReader(filename)
 	if err != nil {
@@ -128,28 +134,15 @@ func parseMetadata(zr *zip.ReadCloser) (*Metadata, error) {
 }
 
 func parseToolpath(zr *zip.ReadCloser) (*Toolpath, error) {
-	var tp Toolpath
-	found := false
-
-	for _, f := range zr.File {
-		if f.Name != "print.jsontoolpath" {
-			continue
-		}
-
-		found = true
-
-		fc, err := f.Open()
-		if err != nil {
-			return nil, err
-		}
-
-		dec := json.NewDecoder(fc)
-		dec.Decode(&tp)
-		break
+	tr, err := OpenToolpath(zr)
+	if err != nil {
+		return nil, fmt.Errorf("parseToolpath: %s", err)
 	}
+	defer tr.Close()
 
-	if !found {
-		return nil, errors.New("parseToolpath: malformed .makerbot file; does not have toolpath")
+	tp, err := tr.ReadAll()
+	if err != nil {
+		return nil, err
 	}
 
 	return &tp, nil
@@ -177,12 +170,12 @@ func parseThumbnail(f *zip.File) (*Thumbnail, error) {
 		return nil, err
 	}
 
-	img, err := png.DecodeConfig(fc)
+	data, err := ioutil.ReadAll(fc)
 	if err != nil {
 		return nil, err
 	}
 
-	data, err := ioutil.ReadAll(fc)
+	img, err := png.DecodeConfig(bytes.NewReader(data))
 	if err != nil {
 		return nil, err
 	}
@@ -1,6 +1,11 @@
 package printfile_test
 
 import (
+	"archive/zip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/tjhorner/makerbot-rpc/printfile"
@@ -69,3 +74,47 @@ func TestGetFileToolpath(t *testing.T) {
 		t.Errorf("toolpath commands size is wrong; wanted: %d, got: %d\n", expectedToolpathCommands, len(*tp))
 	}
 }
+
+func TestGetFileToolpathErrors(t *testing.T) {
+	const unknownMethod = 99
+
+	dir, done := tempDir(t)
+	defer done()
+
+	tests := []struct {
+		name   string
+		method uint16
+		want   string
+	}{
+		{"meta.json", zip.Deflate, "does not have toolpath"},
+		{"print.jsontoolpath", unknownMethod, "unsupported compression algorithm"},
+	}
+
+	for _, test := range tests {
+		src := filepath.Join(dir, "src.makerbot")
+		f, err := os.Create(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		zw := zip.NewWriter(f)
+		// Stores entries with an unknown method, which readers refuse to open
+		zw.RegisterCompressor(unknownMethod, func(w io.Writer) (io.WriteCloser, error) {
+			return nopWriteCloser{w}, nil
+		})
+
+		w, _ := zw.CreateHeader(&zip.FileHeader{Name: test.name, Method: test.method})
+		w.Write([]byte("[]"))
+		zw.Close()
+		f.Close()
+
+		_, err = printfile.GetFileToolpath(src)
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%s with method %d: got error %v, wanted one containing %q", test.name, test.method, err, test.want)
+		}
+	}
+}
+
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
@@ -0,0 +1,410 @@
+package printfile
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"math"
+)
+
+// LastLayer can be used as RenderOptions.Layer to render the top layer
+const LastLayer = -1
+
+// DefaultTagColors are the colors extrusion moves are drawn in,
+// depending on their tags
+var DefaultTagColors = map[string]color.RGBA{
+	"Inset":      {0x1f, 0x77, 0xb4, 0xff},
+	"Infill":     {0xff, 0x7f, 0x0e, 0xff},
+	"Support":    {0x2c, 0xa0, 0x2c, 0xff},
+	"Connection": {0x94, 0x67, 0xbd, 0xff},
+	"Raft":       {0x8c, 0x56, 0x4b, 0xff},
+	"Purge":      {0xe3, 0x77, 0xc2, 0xff},
+}
+
+// RenderOptions configures RenderToolpath. Zero-valued fields use their
+// defaults.
+type RenderOptions struct {
+	Layer      int                   // Index of the layer to draw, or LastLayer (default 0, the first layer)
+	Cumulative bool                  // Also draw every layer below Layer, faded
+	Width      int                   // Width of the image in pixels (default 512)
+	Height     int                   // Height of the image in pixels (default 512)
+	Bounds     *Bounds               // Area of the build plate to draw (default: fit the extrusion moves)
+	LineWidth  float64               // Width of extrusion lines in mm (default 0.4)
+	HideTravel bool                  // Don't draw travel moves
+	TagColors  map[string]color.RGBA // Colors of extrusion moves by tag; the first tag with a color is used (default DefaultTagColors)
+	Extrusion  color.RGBA            // Color of extrusion moves without a tag color (default dark gray)
+	Travel     color.RGBA            // Color of travel moves (default light gray)
+	Background color.RGBA            // Background color (default white)
+}
+
+func (o *RenderOptions) setDefaults() {
+	if o.Width <= 0 {
+		o.Width = 512
+	}
+
+	if o.Height <= 0 {
+		o.Height = 512
+	}
+
+	if o.LineWidth <= 0 {
+		o.LineWidth = 0.4
+	}
+
+	if o.TagColors == nil {
+		o.TagColors = DefaultTagColors
+	}
+
+	if o.Extrusion == (color.RGBA{}) {
+		o.Extrusion = color.RGBA{0x44, 0x44, 0x44, 0xff}
+	}
+
+	if o.Travel == (color.RGBA{}) {
+		o.Travel = color.RGBA{0xbb, 0xbb, 0xbb, 0xff}
+	}
+
+	if o.Background == (color.RGBA{}) {
+		o.Background = color.RGBA{0xff, 0xff, 0xff, 0xff}
+	}
+}
+
+// Bounds is an area of the build plate, in mm
+type Bounds struct {
+	MinX, MinY, MaxX, MaxY float64
+}
+
+// BoundsFromMetadata returns the area the print covers according to
+// `m`. Use it as RenderOptions.Bounds to render every layer of a print
+// at the same scale.
+func BoundsFromMetadata(m *Metadata) *Bounds {
+	bb := m.BoundingBox
+	return &Bounds{bb.XMin, bb.YMin, bb.XMax, bb.YMax}
+}
+
+// stroke is a move to draw, in mm
+type stroke struct {
+	x0, y0, x1, y1 float64
+	layer          int
+	travel         bool
+	color          color.RGBA
+}
+
+// Rendering is a top-down view of one or more layers of a toolpath,
+// which can be encoded as PNG or SVG
+type Rendering struct {
+	Layer   LayerStats // The layer that was rendered (the top one, if Cumulative)
+	opts    RenderOptions
+	strokes []stroke
+	minX    float64
+	minY    float64
+	scale   float64 // pixels per mm
+}
+
+// RenderFileToolpath streams the toolpath of a .makerbot file given a
+// filepath through RenderToolpath
+func RenderFileToolpath(filename string, opts RenderOptions) (*Rendering, error) {
+	tr, err := OpenFileToolpath(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer tr.Close()
+
+	return RenderToolpath(tr, opts)
+}
+
+// RenderToolpath draws a layer of a toolpath (or a stack of layers, with
+// RenderOptions.Cumulative) as seen from the top. Layers are the same
+// as the ones AnalyzeToolpath reports. Only the moves that are drawn are
+// kept in memory, so it works with ToolpathReader on big toolpaths.
+func RenderToolpath(it ToolpathIterator, opts RenderOptions) (*Rendering, error) {
+	if opts.Layer < LastLayer {
+		return nil, fmt.Errorf("cannot render layer %d", opts.Layer)
+	}
+
+	opts.setDefaults()
+
+	r := &Rendering{opts: opts}
+
+	var layer LayerStats
+	layers := 0
+
+	_, err := walkSegments(it, func(seg *segment) {
+		if seg.layer < 0 {
+			return
+		}
+
+		if seg.layer == layers {
+			layers++
+
+			// Only the last layer seen so far is wanted; forget the previous one
+			if opts.Layer == LastLayer {
+				if !opts.Cumulative {
+					r.strokes = r.strokes[:0]
+				}
+
+				layer = LayerStats{Index: seg.layer, Z: seg.layerZ}
+			}
+		}
+
+		if opts.Layer >= 0 {
+			if seg.layer > opts.Layer || (!opts.Cumulative && seg.layer < opts.Layer) {
+				return
+			}
+
+			if seg.layer == opts.Layer {
+				layer = LayerStats{Index: seg.layer, Z: seg.layerZ}
+			}
+		}
+
+		if seg.distance == 0 || (!seg.extruding() && opts.HideTravel) {
+			return
+		}
+
+		r.strokes = append(r.strokes, stroke{
+			x0: seg.from.x, y0: seg.from.y,
+			x1: seg.to.x, y1: seg.to.y,
+			layer:  seg.layer,
+			travel: !seg.extruding(),
+			color:  r.colorOf(seg.tags),
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Layer >= layers || layers == 0 {
+		return nil, fmt.Errorf("cannot render layer %d; toolpath has %d layers", opts.Layer, layers)
+	}
+
+	r.Layer = layer
+	r.fade()
+	r.fit()
+
+	return r, nil
+}
+
+func (r *Rendering) colorOf(tags []string) color.RGBA {
+	for _, tag := range tags {
+		if c, ok := r.opts.TagColors[tag]; ok {
+			return c
+		}
+	}
+
+	return r.opts.Extrusion
+}
+
+// fade blends the extrusion moves of the layers below the rendered one
+// with the background, and drops their travel moves. It has to be done
+// after walking the toolpath, since until then we don't know which
+// layer is the top one.
+func (r *Rendering) fade() {
+	if !r.opts.Cumulative {
+		return
+	}
+
+	strokes := r.strokes[:0]
+	for _, s := range r.strokes {
+		if s.layer < r.Layer.Index {
+			if s.travel {
+				continue
+			}
+
+			s.color = blend(s.color, r.opts.Background, 0.6)
+		}
+
+		strokes = append(strokes, s)
+	}
+
+	r.strokes = strokes
+}
+
+func (r *Rendering) fit() {
+	var minX, minY, maxX, maxY float64
+
+	if b := r.opts.Bounds; b != nil {
+		minX, minY, maxX, maxY = b.MinX, b.MinY, b.MaxX, b.MaxY
+	} else {
+		minX, minY = math.Inf(1), math.Inf(1)
+		maxX, maxY = math.Inf(-1), math.Inf(-1)
+
+		// Fit the extrusion moves; travel moves can come from far away
+		// (e.g. from the start position) and are clipped
+		for _, s := range r.strokes {
+			if s.travel {
+				continue
+			}
+
+			minX, maxX = math.Min(minX, math.Min(s.x0, s.x1)), math.Max(maxX, math.Max(s.x0, s.x1))
+			minY, maxY = math.Min(minY, math.Min(s.y0, s.y1)), math.Max(maxY, math.Max(s.y0, s.y1))
+		}
+
+		if math.IsInf(minX, 1) {
+			minX, minY, maxX, maxY = 0, 0, 1, 1
+		}
+
+		// Leave room for the width of the lines at the edges
+		margin := r.opts.LineWidth
+		minX, minY, maxX, maxY = minX-margin, minY-margin, maxX+margin, maxY+margin
+	}
+
+	w, h := math.Max(maxX-minX, 1e-6), math.Max(maxY-minY, 1e-6)
+	r.scale = math.Min(float64(r.opts.Width)/w, float64(r.opts.Height)/h)
+
+	// Center the drawing
+	r.minX = minX - (float64(r.opts.Width)/r.scale-w)/2
+	r.minY = minY - (float64(r.opts.Height)/r.scale-h)/2
+}
+
+// px converts a point on the build plate to pixels. Y points up on the
+// build plate and down in images.
+func (r *Rendering) px(x, y float64) (float64, float64) {
+	return (x - r.minX) * r.scale, float64(r.opts.Height) - (y-r.minY)*r.scale
+}
+
+// Image draws the rendering
+func (r *Rendering) Image() *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, r.opts.Width, r.opts.Height))
+
+	draw.Draw(img, img.Bounds(), image.NewUniform(r.opts.Background), image.Point{}, draw.Src)
+
+	// Travel moves go under extrusion moves
+	for _, travel := range []bool{true, false} {
+		for _, s := range r.strokes {
+			if s.travel != travel {
+				continue
+			}
+
+			x0, y0 := r.px(s.x0, s.y0)
+			x1, y1 := r.px(s.x1, s.y1)
+
+			if s.travel {
+				drawLine(img, x0, y0, x1, y1, 0.5, r.opts.Travel, 4)
+			} else {
+				drawLine(img, x0, y0, x1, y1, math.Max(0.5, r.opts.LineWidth*r.scale/2), s.color, 0)
+			}
+		}
+	}
+
+	return img
+}
+
+// PNG writes the rendering to `w` as a PNG image
+func (r *Rendering) PNG(w io.Writer) error {
+	return png.Encode(w, r.Image())
+}
+
+// SVG writes the rendering to `w` as an SVG image. Moves are kept as
+// vectors, in the same pixel coordinates as Image.
+func (r *Rendering) SVG(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+
+	bg := r.opts.Background
+	fmt.Fprintf(bw, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d">`+"\n", r.opts.Width, r.opts.Height, r.opts.Width, r.opts.Height)
+	fmt.Fprintf(bw, `<rect width="100%%" height="100%%" fill="%s"/>`+"\n", hexColor(bg))
+
+	lineWidth := math.Max(1, r.opts.LineWidth*r.scale)
+
+	for _, travel := range []bool{true, false} {
+		// Consecutive moves of the same color are joined into one path
+		// to keep the file small
+		var current *color.RGBA
+		var lastX, lastY float64
+
+		end := func() {
+			if current != nil {
+				bw.WriteString(`"/>` + "\n")
+				current = nil
+			}
+		}
+
+		for _, s := range r.strokes {
+			if s.travel != travel {
+				continue
+			}
+
+			x0, y0 := r.px(s.x0, s.y0)
+			x1, y1 := r.px(s.x1, s.y1)
+
+			if current == nil || *current != s.color {
+				end()
+
+				c := s.color
+				current = &c
+
+				if travel {
+					fmt.Fprintf(bw, `<path fill="none" stroke="%s" stroke-width="1" stroke-dasharray="4 4" d="`, hexColor(r.opts.Travel))
+				} else {
+					fmt.Fprintf(bw, `<path fill="none" stroke="%s" stroke-width="%.2f" stroke-linecap="round" stroke-linejoin="round" d="`, hexColor(c), lineWidth)
+				}
+
+				fmt.Fprintf(bw, "M%.2f %.2f", x0, y0)
+			} else if x0 != lastX || y0 != lastY {
+				fmt.Fprintf(bw, "M%.2f %.2f", x0, y0)
+			}
+
+			fmt.Fprintf(bw, "L%.2f %.2f", x1, y1)
+			lastX, lastY = x1, y1
+		}
+
+		end()
+	}
+
+	bw.WriteString("</svg>\n")
+	return bw.Flush()
+}
+
+func hexColor(c color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+// blend mixes `amount` (0-1) of `b` into `a`
+func blend(a, b color.RGBA, amount float64) color.RGBA {
+	mix := func(x, y uint8) uint8 {
+		return uint8(math.Round(float64(x)*(1-amount) + float64(y)*amount))
+	}
+
+	return color.RGBA{mix(a.R, b.R), mix(a.G, b.G), mix(a.B, b.B), mix(a.A, b.A)}
+}
+
+// drawLine draws a line `radius` pixels thick with round ends by
+// stamping discs along it. If `dash` isn't 0, the line is dashed with
+// dashes that long.
+func drawLine(img *image.RGBA, x0, y0, x1, y1, radius float64, c color.RGBA, dash float64) {
+	length := math.Hypot(x1-x0, y1-y0)
+	steps := int(math.Ceil(length*2)) + 1
+
+	for i := 0; i <= steps; i++ {
+		t := float64(i) / float64(steps)
+
+		if dash > 0 && int(t*length/dash)%2 == 1 {
+			continue
+		}
+
+		fillDisc(img, x0+(x1-x0)*t, y0+(y1-y0)*t, radius, c)
+	}
+}
+
+func fillDisc(img *image.RGBA, cx, cy, radius float64, c color.RGBA) {
+	b := img.Bounds()
+
+	x0, x1 := int(math.Floor(cx-radius)), int(math.Ceil(cx+radius))
+	y0, y1 := int(math.Floor(cy-radius)), int(math.Ceil(cy+radius))
+
+	for y := y0; y <= y1; y++ {
+		for x := x0; x <= x1; x++ {
+			if !image.Pt(x, y).In(b) {
+				continue
+			}
+
+			dx, dy := float64(x)+0.5-cx, float64(y)+0.5-cy
+			if dx*dx+dy*dy > radius*radius {
+				continue
+			}
+
+			img.SetRGBA(x, y, c)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package printfile_test
+
+import (
+	"bytes"
+	"errors"
+	"image/color"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/tjhorner/makerbot-rpc/printfile"
+)
+
+func tagged(inst printfile.ToolpathInstruction, tags ...string) printfile.ToolpathInstruction {
+	inst.Command.Tags = tags
+	return inst
+}
+
+// renderTestToolpath has two layers: a horizontal line of infill and a
+// vertical line of inset above it, joined by a travel move
+var renderTestToolpath = printfile.Toolpath{
+	move(0, 0, 0.2, 0, 10, false),
+	tagged(move(10, 0, 0.2, 1, 10, false), "Infill"),
+	tagged(move(5, -5, 0.4, 1, 10, false), "Travel Move"),
+	tagged(move(5, 5, 0.4, 2, 10, false), "Inset"),
+}
+
+func TestRenderToolpath(t *testing.T) {
+	opts := printfile.RenderOptions{
+		Width:  100,
+		Height: 100,
+		Bounds: &printfile.Bounds{MinX: 0, MinY: -5, MaxX: 10, MaxY: 5},
+	}
+
+	infill := printfile.DefaultTagColors["Infill"]
+	inset := printfile.DefaultTagColors["Inset"]
+	white := color.RGBA{0xff, 0xff, 0xff, 0xff}
+
+	for _, tt := range []struct {
+		layer      int
+		cumulative bool
+		pixels     map[[2]int]color.RGBA
+	}{
+		{0, false, map[[2]int]color.RGBA{{25, 50}: infill, {50, 25}: white, {5, 5}: white}},
+		{1, false, map[[2]int]color.RGBA{{25, 50}: white, {50, 25}: inset}},
+		{printfile.LastLayer, false, map[[2]int]color.RGBA{{25, 50}: white, {50, 25}: inset}},
+		{1, true, map[[2]int]color.RGBA{{25, 50}: {0xff, 0xcc, 0x9f, 0xff}, {50, 25}: inset}},
+	} {
+		opts.Layer = tt.layer
+		opts.Cumulative = tt.cumulative
+
+		r, err := printfile.RenderToolpath(renderTestToolpath.Iterator(), opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var buf bytes.Buffer
+		if err := r.PNG(&buf); err != nil {
+			t.Fatal(err)
+		}
+
+		img, err := png.Decode(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for pt, want := range tt.pixels {
+			if got := color.RGBAModel.Convert(img.At(pt[0], pt[1])); got != want {
+				t.Errorf("layer %d (cumulative %t): pixel %v is %v, wanted %v", tt.layer, tt.cumulative, pt, got, want)
+			}
+		}
+	}
+}
+
+func TestRenderToolpathSVG(t *testing.T) {
+	r, err := printfile.RenderToolpath(renderTestToolpath.Iterator(), printfile.RenderOptions{Layer: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := r.SVG(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	svg := buf.String()
+	for _, want := range []string{`<svg xmlns="http://www.w3.org/2000/svg" width="512" height="512"`, `stroke="#1f77b4"`, `stroke-dasharray="4 4"`} {
+		if !strings.Contains(svg, want) {
+			t.Errorf("SVG doesn't contain %s:\n%s", want, svg)
+		}
+	}
+
+	if strings.Contains(svg, `stroke="#ff7f0e"`) {
+		t.Error("SVG of layer 1 contains infill from layer 0")
+	}
+}
+
+func TestRenderToolpathLayerOutOfRange(t *testing.T) {
+	for _, layer := range []int{2, -2} {
+		_, err := printfile.RenderToolpath(renderTestToolpath.Iterator(), printfile.RenderOptions{Layer: layer})
+		if err == nil {
+			t.Errorf("expected an error rendering layer %d", layer)
+		}
+	}
+
+	// Negative layers are refused before the toolpath is read
+	tr := printfile.NewToolpathReader(failingReader{})
+	_, err := printfile.RenderToolpath(tr, printfile.RenderOptions{Layer: -2})
+	if err == nil || strings.Contains(err.Error(), "toolpath was read") {
+		t.Errorf("got error %v rendering layer -2", err)
+	}
+}
+
+func TestRenderFileToolpath(t *testing.T) {
+	r, err := printfile.RenderFileToolpath(file, printfile.RenderOptions{Layer: printfile.LastLayer, Cumulative: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r.Layer.Index != expectedLayers-1 {
+		t.Errorf("rendered layer %d, wanted the last one (%d)", r.Layer.Index, expectedLayers-1)
+	}
+
+	var buf bytes.Buffer
+	if err := r.PNG(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := png.DecodeConfig(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.Width != 512 || cfg.Height != 512 {
+		t.Errorf("got a %dx%d image, wanted 512x512", cfg.Width, cfg.Height)
+	}
+}
+
+// failingReader fails every read with "toolpath was read"
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) { return 0, errors.New("toolpath was read") }
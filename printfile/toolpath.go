@@ -0,0 +1,484 @@
+package printfile
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+)
+
+const toolpathFile = "print.jsontoolpath"
+
+// ToolpathIterator walks a toolpath one instruction at a time. Next
+// returns io.EOF after the last instruction.
+//
+// Both ToolpathReader (which streams from a file) and Toolpath (through
+// Toolpath.Iterator) implement it, so code that only needs to look at
+// every instruction once can work with either.
+type ToolpathIterator interface {
+	Next() (*ToolpathInstruction, error)
+}
+
+// ToolpathReader streams a toolpath from its JSON representation
+// without loading all of it into memory
+type ToolpathReader struct {
+	dec     *json.Decoder
+	closers []io.Closer
+	started bool
+	err     error
+}
+
+// NewToolpathReader creates a ToolpathReader that reads the JSON
+// toolpath (the contents of print.jsontoolpath) from `r`
+func NewToolpathReader(r io.Reader) *ToolpathReader {
+	return &ToolpathReader{dec: json.NewDecoder(r)}
+}
+
+// OpenToolpath opens the toolpath of a .makerbot file given a
+// zip.ReadCloser. Close the ToolpathReader when done with it; `r` is
+// left open.
+func OpenToolpath(r *zip.ReadCloser) (*ToolpathReader, error) {
+	for _, f := range r.File {
+		if f.Name != toolpathFile {
+			continue
+		}
+
+		fc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+
+		tr := NewToolpathReader(fc)
+		tr.closers = []io.Closer{fc}
+		return tr, nil
+	}
+
+	return nil, errors.New("OpenToolpath: malformed .makerbot file; does not have toolpath")
+}
+
+// OpenFileToolpath opens the toolpath of a .makerbot file given a
+// filepath. Closing the ToolpathReader closes the file.
+func OpenFileToolpath(filename string) (*ToolpathReader, error) {
+	rc, err := zip.OpenReader(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	tr, err := OpenToolpath(rc)
+	if err != nil {
+		rc.Close()
+		return nil, err
+	}
+
+	tr.closers = append(tr.closers, rc)
+	return tr, nil
+}
+
+// Next decodes the next instruction of the toolpath. It returns io.EOF
+// after the last one; any other error means the toolpath is malformed
+// (or could not be read), and Next keeps returning it.
+func (r *ToolpathReader) Next() (*ToolpathInstruction, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	if !r.started {
+		r.started = true
+
+		tok, err := r.dec.Token()
+		if err != nil {
+			return nil, r.fail(err)
+		}
+
+		if delim, ok := tok.(json.Delim); !ok || delim != '[' {
+			return nil, r.fail(fmt.Errorf("toolpath is not a JSON array (starts with %v)", tok))
+		}
+	}
+
+	if !r.dec.More() {
+		// Consume the closing bracket
+		_, err := r.dec.Token()
+		if err != nil {
+			return nil, r.fail(err)
+		}
+
+		r.err = io.EOF
+		return nil, io.EOF
+	}
+
+	var inst ToolpathInstruction
+	err := r.dec.Decode(&inst)
+	if err != nil {
+		return nil, r.fail(err)
+	}
+
+	return &inst, nil
+}
+
+func (r *ToolpathReader) fail(err error) error {
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+
+	r.err = fmt.Errorf("reading toolpath: %s", err)
+	return r.err
+}
+
+// Close closes the underlying file, if the ToolpathReader was opened
+// with OpenToolpath or OpenFileToolpath
+func (r *ToolpathReader) Close() error {
+	var err error
+	for _, c := range r.closers {
+		if cerr := c.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+
+	r.closers = nil
+	return err
+}
+
+// ReadAll reads the rest of the toolpath into a Toolpath
+func (r *ToolpathReader) ReadAll() (Toolpath, error) {
+	tp := Toolpath{}
+	for {
+		inst, err := r.Next()
+		if err == io.EOF {
+			return tp, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		tp = append(tp, *inst)
+	}
+}
+
+type toolpathIterator struct {
+	tp Toolpath
+	i  int
+}
+
+func (it *toolpathIterator) Next() (*ToolpathInstruction, error) {
+	if it.i >= len(it.tp) {
+		return nil, io.EOF
+	}
+
+	it.i++
+	return &it.tp[it.i-1], nil
+}
+
+// Iterator returns a ToolpathIterator over the instructions of `tp`
+func (tp Toolpath) Iterator() ToolpathIterator {
+	return &toolpathIterator{tp: tp}
+}
+
+// parameterKeys is a set of ToolpathParameters fields, one bit per field
+type parameterKeys uint16
+
+// The bits of parameterKeys, in the order the fields are written
+const (
+	keyA parameterKeys = 1 << iota
+	keyComment
+	keyFeedRate
+	keyIndex
+	keySeconds
+	keyTemperature
+	keyValue
+	keyX
+	keyY
+	keyZ
+	keyCount = iota
+)
+
+// toolpathParameterKeys are the JSON keys of the parameterKeys bits
+var toolpathParameterKeys = [keyCount]string{"a", "comment", "feedrate", "index", "seconds", "temperature", "value", "x", "y", "z"}
+
+// defaultParameterKeys are the keys written for commands that weren't
+// read from JSON, by Function
+var defaultParameterKeys = map[string]parameterKeys{
+	"move":                     keyA | keyFeedRate | keyX | keyY | keyZ,
+	"comment":                  keyComment,
+	"fan_duty":                 keyIndex | keyValue,
+	"toggle_fan":               keyIndex | keyValue,
+	"set_toolhead_temperature": keyIndex | keyTemperature,
+	"wait_for_temperature":     keyIndex,
+	"delay":                    keySeconds,
+}
+
+// parameterKey returns the bit for the JSON key `key`, or 0 if it isn't
+// a field
+func parameterKey(key string) parameterKeys {
+	switch key {
+	case "a":
+		return keyA
+	case "comment":
+		return keyComment
+	case "feedrate":
+		return keyFeedRate
+	case "index":
+		return keyIndex
+	case "seconds":
+		return keySeconds
+	case "temperature":
+		return keyTemperature
+	case "value":
+		return keyValue
+	case "x":
+		return keyX
+	case "y":
+		return keyY
+	case "z":
+		return keyZ
+	}
+
+	return 0
+}
+
+// scanParameterKeys returns the fields whose keys are in the JSON object
+// `b`, and whether it has other keys. Keys with escapes count as other
+// keys.
+func scanParameterKeys(b []byte) (keys parameterKeys, other bool) {
+	depth := 0
+	wantKey := false
+
+	for i := 0; i < len(b); i++ {
+		switch b[i] {
+		case '{', '[':
+			depth++
+			wantKey = depth == 1 && b[i] == '{'
+		case '}', ']':
+			depth--
+		case ',':
+			wantKey = depth == 1
+		case '"':
+			start := i + 1
+			escaped := false
+			for i++; i < len(b) && b[i] != '"'; i++ {
+				if b[i] == '\\' {
+					escaped = true
+					i++
+				}
+			}
+
+			if !wantKey {
+				continue
+			}
+
+			wantKey = false
+			key := parameterKey(string(b[start:i]))
+			if key == 0 || escaped {
+				other = true
+			}
+
+			keys |= key
+		}
+	}
+
+	return keys, other
+}
+
+// toolpathParameters has the fields of ToolpathParameters without its
+// methods, for decoding them with encoding/json
+type toolpathParameters ToolpathParameters
+
+// UnmarshalJSON implements json.Unmarshaler. Parameters that aren't
+// fields are kept, and written back by MarshalJSON.
+func (p *ToolpathParameters) UnmarshalJSON(b []byte) error {
+	*p = ToolpathParameters{}
+
+	err := json.Unmarshal(b, (*toolpathParameters)(p))
+	if err != nil {
+		if terr, ok := err.(*json.UnmarshalTypeError); ok {
+			return fmt.Errorf("parameter %s: %s", terr.Field, err)
+		}
+
+		return err
+	}
+
+	keys, other := scanParameterKeys(b)
+	if other {
+		keys, err = p.readExtra(b)
+		if err != nil {
+			return err
+		}
+	}
+
+	p.read = true
+	p.keys = keys
+	return nil
+}
+
+// readExtra keeps the keys of the JSON object `b` that aren't fields in
+// p.extra, and returns the ones that are
+func (p *ToolpathParameters) readExtra(b []byte) (parameterKeys, error) {
+	var raw map[string]json.RawMessage
+	err := json.Unmarshal(b, &raw)
+	if err != nil {
+		return 0, err
+	}
+
+	names := make([]string, 0, len(raw))
+	for name := range raw {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	var (
+		keys  parameterKeys
+		extra bytes.Buffer
+	)
+
+	for _, name := range names {
+		if key := parameterKey(name); key != 0 {
+			keys |= key
+			continue
+		}
+
+		if extra.Len() > 0 {
+			extra.WriteByte(',')
+		}
+
+		k, _ := json.Marshal(name)
+		extra.Write(k)
+		extra.WriteByte(':')
+		extra.Write(raw[name])
+	}
+
+	p.extra = extra.String()
+	return keys, nil
+}
+
+// value returns the value of the field for `key`
+func (p *ToolpathParameters) value(key parameterKeys) interface{} {
+	switch key {
+	case keyA:
+		return p.A
+	case keyComment:
+		return p.Comment
+	case keyFeedRate:
+		return p.FeedRate
+	case keyIndex:
+		return p.Index
+	case keySeconds:
+		return p.Seconds
+	case keyTemperature:
+		return p.Temperature
+	case keyValue:
+		return p.Value
+	case keyX:
+		return p.X
+	case keyY:
+		return p.Y
+	case keyZ:
+		return p.Z
+	}
+
+	return nil
+}
+
+// nonZero returns the fields that aren't zero
+func (p *ToolpathParameters) nonZero() parameterKeys {
+	var keys parameterKeys
+	set := func(key parameterKeys, nonZero bool) {
+		if nonZero {
+			keys |= key
+		}
+	}
+
+	set(keyA, p.A != 0)
+	set(keyComment, p.Comment != "")
+	set(keyFeedRate, p.FeedRate != 0)
+	set(keyIndex, p.Index != 0)
+	set(keySeconds, p.Seconds != 0)
+	set(keyTemperature, p.Temperature != 0)
+	set(keyValue, p.Value != nil)
+	set(keyX, p.X != 0)
+	set(keyY, p.Y != 0)
+	set(keyZ, p.Z != 0)
+	return keys
+}
+
+// marshal writes the parameters for a command with `function`: the keys
+// that were read or, if the parameters weren't read from JSON, the usual
+// keys for `function`. Fields that aren't zero are always written, so
+// setting one on a parsed command isn't lost.
+func (p *ToolpathParameters) marshal(function string) ([]byte, error) {
+	keys := p.keys
+	if !p.read {
+		keys = defaultParameterKeys[function]
+	}
+
+	keys |= p.nonZero()
+
+	var b bytes.Buffer
+	b.WriteByte('{')
+
+	for i, name := range toolpathParameterKeys {
+		key := parameterKeys(1) << uint(i)
+		if keys&key == 0 {
+			continue
+		}
+
+		j, err := json.Marshal(p.value(key))
+		if err != nil {
+			return nil, err
+		}
+
+		if b.Len() > 1 {
+			b.WriteByte(',')
+		}
+
+		b.WriteByte('"')
+		b.WriteString(name)
+		b.WriteString(`":`)
+		b.Write(j)
+	}
+
+	if p.extra != "" {
+		if b.Len() > 1 {
+			b.WriteByte(',')
+		}
+
+		b.WriteString(p.extra)
+	}
+
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
+// MarshalJSON implements json.Marshaler, writing the command the way
+// MakerBot Print does: moves have `relative` metadata and other
+// commands have empty metadata.
+func (c ToolpathCommand) MarshalJSON() ([]byte, error) {
+	params, err := c.Parameters.marshal(c.Function)
+	if err != nil {
+		return nil, err
+	}
+
+	rel := c.Metadata.Relative
+	metadata := json.RawMessage("{}")
+	if c.Function == "move" || rel.A || rel.X || rel.Y || rel.Z {
+		metadata, err = json.Marshal(c.Metadata)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	tags := c.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+
+	return json.Marshal(struct {
+		Function   string          `json:"function"`
+		Metadata   json.RawMessage `json:"metadata"`
+		Parameters json.RawMessage `json:"parameters"`
+		Tags       []string        `json:"tags"`
+	}{c.Function, metadata, params, tags})
+}
@@ -0,0 +1,154 @@
+package printfile_test
+
+import (
+	"io"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/tjhorner/makerbot-rpc/printfile"
+)
+
+func TestOpenFileToolpath(t *testing.T) {
+	tr, err := printfile.OpenFileToolpath(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tr.Close()
+
+	tp, err := printfile.GetFileToolpath(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n := 0
+	for {
+		inst, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if inst.Command.Function != (*tp)[n].Command.Function || !reflect.DeepEqual(inst.Command.Parameters, (*tp)[n].Command.Parameters) {
+			t.Fatalf("instruction %d differs from GetFileToolpath: %+v", n, inst)
+		}
+
+		n++
+	}
+
+	if n != expectedToolpathCommands {
+		t.Errorf("toolpath commands size is wrong; wanted: %d, got: %d\n", expectedToolpathCommands, n)
+	}
+
+	if _, err := tr.Next(); err != io.EOF {
+		t.Errorf("Next after the end returned %v, want io.EOF", err)
+	}
+}
+
+func TestToolpathReaderMalformed(t *testing.T) {
+	for _, src := range []string{
+		`{"command":{}}`,
+		`[{"command":{"function":"move"}},`,
+		`[{"command":{"function":"move"}} {"command":{}}]`,
+		``,
+	} {
+		tr := printfile.NewToolpathReader(strings.NewReader(src))
+
+		var err error
+		for err == nil {
+			_, err = tr.Next()
+		}
+
+		if err == io.EOF {
+			t.Errorf("%q: got io.EOF, want an error", src)
+		}
+	}
+}
+
+func TestToolpathIterator(t *testing.T) {
+	tp := printfile.Toolpath{{}, {}}
+	it := tp.Iterator()
+
+	for i := 0; i < 2; i++ {
+		inst, err := it.Next()
+		if err != nil || inst != &tp[i] {
+			t.Fatalf("instruction %d: got %p, %v", i, inst, err)
+		}
+	}
+
+	if _, err := it.Next(); err != io.EOF {
+		t.Errorf("got %v after the last instruction, want io.EOF", err)
+	}
+}
+
+// heapInUse returns the live heap after a garbage collection
+func heapInUse() int64 {
+	var m runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&m)
+	return int64(m.HeapAlloc)
+}
+
+// The benchmarks report "peak-B/op": the most heap that was live at
+// once while walking the toolpath, which is what matters for big files.
+
+func BenchmarkToolpathSlice(b *testing.B) {
+	b.ReportAllocs()
+
+	var peak int64
+	for i := 0; i < b.N; i++ {
+		base := heapInUse()
+
+		tp, err := printfile.GetFileToolpath(file)
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		if used := heapInUse() - base; used > peak {
+			peak = used
+		}
+
+		runtime.KeepAlive(tp)
+	}
+
+	b.ReportMetric(float64(peak), "peak-B/op")
+}
+
+func BenchmarkToolpathReader(b *testing.B) {
+	b.ReportAllocs()
+
+	var peak int64
+	for i := 0; i < b.N; i++ {
+		base := heapInUse()
+
+		tr, err := printfile.OpenFileToolpath(file)
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		for n := 0; ; n++ {
+			_, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			if n%1000 == 0 {
+				if used := heapInUse() - base; used > peak {
+					peak = used
+				}
+			}
+		}
+
+		tr.Close()
+	}
+
+	b.ReportMetric(float64(peak), "peak-B/op")
+}
@@ -47,14 +47,27 @@ type ToolpathCommand struct {
 			Z bool `json:"z"`
 		} `json:"relative"`
 	} `json:"metadata"`
-	Parameters struct {
-		A        float64 `json:"a"`
-		FeedRate float64 `json:"feedrate"`
-		X        float64 `json:"x"`
-		Y        float64 `json:"y"`
-		Z        float64 `json:"z"`
-	} `json:"parameters"`
-	Tags []string `json:"tags"`
+	Parameters ToolpathParameters `json:"parameters"`
+	Tags       []string           `json:"tags"`
+}
+
+// ToolpathParameters are the parameters of a ToolpathCommand. Which
+// ones are used depends on the command's Function.
+type ToolpathParameters struct {
+	A           float64     `json:"a"`           // move: filament position
+	FeedRate    float64     `json:"feedrate"`    // move: speed in mm/s
+	X           float64     `json:"x"`           // move
+	Y           float64     `json:"y"`           // move
+	Z           float64     `json:"z"`           // move
+	Comment     string      `json:"comment"`     // comment
+	Index       int         `json:"index"`       // fan_duty, toggle_fan, set_toolhead_temperature, ...: the fan or toolhead
+	Value       interface{} `json:"value"`       // fan_duty: the duty cycle (float64); toggle_fan: whether it's on (bool)
+	Temperature float64     `json:"temperature"` // set_toolhead_temperature: temperature in °C
+	Seconds     float64     `json:"seconds"`     // delay
+
+	read  bool          // Whether the parameters were read from JSON
+	keys  parameterKeys // The keys that were in the JSON, so that they are written back the same
+	extra string        // Keys that aren't fields, as a JSON object body (`"key":value,...`)
 }
 
 // Metadata is a representation of the meta.json
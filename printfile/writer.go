@@ -0,0 +1,385 @@
+package printfile
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	metadataFile = "meta.json"
+	zipComment   = "MakerBot file"
+)
+
+// Writer writes a .makerbot file. Write its metadata, toolpath and
+// thumbnails in any order, then Close it.
+type Writer struct {
+	zw *zip.Writer
+}
+
+// NewWriter creates a Writer that writes a .makerbot file to `w`
+func NewWriter(w io.Writer) *Writer {
+	zw := zip.NewWriter(w)
+	zw.SetComment(zipComment)
+	return &Writer{zw}
+}
+
+// WriteMetadata writes `m` as the file's meta.json
+func (w *Writer) WriteMetadata(m *Metadata) error {
+	b, err := json.MarshalIndent(m, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	f, err := w.zw.Create(metadataFile)
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(b)
+	return err
+}
+
+// WriteToolpath writes the toolpath from `it` as the file's
+// print.jsontoolpath, one instruction at a time, and returns how many
+// instructions were written. Use ToolpathReader to copy a big toolpath
+// without loading it into memory.
+func (w *Writer) WriteToolpath(it ToolpathIterator) (int, error) {
+	f, err := w.zw.Create(toolpathFile)
+	if err != nil {
+		return 0, err
+	}
+
+	bw := bufio.NewWriter(f)
+
+	// Written the same way MakerBot Print does
+	bw.WriteString("[")
+
+	n := 0
+	for {
+		inst, err := it.Next()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return n, err
+		}
+
+		b, err := json.Marshal(inst.Command)
+		if err != nil {
+			return n, err
+		}
+
+		if n > 0 {
+			bw.WriteString(",")
+		}
+
+		bw.WriteString("{\n\"command\" : ")
+		bw.Write(b)
+		bw.WriteString("\n}")
+		n++
+	}
+
+	bw.WriteString("]")
+	return n, bw.Flush()
+}
+
+// WriteThumbnail writes `t` as a thumbnail_<width>x<height>.png file,
+// named after its TargetWidth and TargetHeight (or its actual size if
+// those aren't set). t.Data has to be a PNG image.
+func (w *Writer) WriteThumbnail(t Thumbnail) error {
+	cfg, err := png.DecodeConfig(bytes.NewReader(t.Data))
+	if err != nil {
+		return fmt.Errorf("thumbnail is not a PNG image: %s", err)
+	}
+
+	width, height := t.TargetWidth, t.TargetHeight
+	if width == 0 || height == 0 {
+		width, height = cfg.Width, cfg.Height
+	}
+
+	f, err := w.zw.Create(fmt.Sprintf("thumbnail_%dx%d.png", width, height))
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(t.Data)
+	return err
+}
+
+// Close finishes writing the file. It does not close the underlying
+// writer.
+func (w *Writer) Close() error {
+	return w.zw.Close()
+}
+
+// WriteFile writes a .makerbot file to a filepath from its metadata,
+// toolpath and thumbnails
+func WriteFile(filename string, m *Metadata, toolpath ToolpathIterator, thumbnails []Thumbnail) error {
+	return writeFileAtomic(filename, func(f io.Writer) error {
+		w := NewWriter(f)
+
+		_, err := w.WriteToolpath(toolpath)
+		if err != nil {
+			return err
+		}
+
+		err = w.WriteMetadata(m)
+		if err != nil {
+			return err
+		}
+
+		for _, t := range thumbnails {
+			err = w.WriteThumbnail(t)
+			if err != nil {
+				return err
+			}
+		}
+
+		return w.Close()
+	})
+}
+
+// writeFileAtomic writes to a temporary file next to `filename` and
+// moves it into place once `write` succeeds, so that `filename` is
+// never left half-written (and can be the file that is being rewritten).
+// An existing `filename` keeps its permissions; new files get 0644.
+func writeFileAtomic(filename string, write func(io.Writer) error) error {
+	mode := os.FileMode(0644)
+	if fi, err := os.Stat(filename); err == nil {
+		mode = fi.Mode().Perm()
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(filename), ".makerbot-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	err = write(f)
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	err = f.Close()
+	if err != nil {
+		return err
+	}
+
+	// TempFile creates files that only their owner can read
+	err = os.Chmod(f.Name(), mode)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), filename)
+}
+
+// Edit is a set of changes to make to a .makerbot file with Rewrite.
+// Whatever is left nil is kept as it is.
+type Edit struct {
+	// Metadata is called with the file's Metadata to change it. Only the
+	// meta.json keys whose value changed are written; the others,
+	// including keys Metadata doesn't have, keep their exact value.
+	Metadata func(m *Metadata)
+
+	// Thumbnails replace all of the file's thumbnails
+	Thumbnails []Thumbnail
+
+	// Toolpath replaces the file's toolpath
+	Toolpath ToolpathIterator
+}
+
+// Rewrite copies the .makerbot file `r` to `w` with the changes in `e`.
+// Entries that aren't changed are copied byte-for-byte, compressed data
+// included, and so are unknown entries.
+func Rewrite(r *zip.ReadCloser, w io.Writer, e Edit) error {
+	out := NewWriter(w)
+	out.zw.SetComment(r.Comment)
+
+	thumbnailsWritten := false
+	writeThumbnails := func() error {
+		thumbnailsWritten = true
+		for _, t := range e.Thumbnails {
+			err := out.WriteThumbnail(t)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	for _, f := range r.File {
+		var err error
+
+		switch {
+		case f.Name == toolpathFile && e.Toolpath != nil:
+			_, err = out.WriteToolpath(e.Toolpath)
+		case f.Name == metadataFile && e.Metadata != nil:
+			err = out.rewriteMetadata(f, e.Metadata)
+		case isThumbnail(f.Name) && e.Thumbnails != nil:
+			// All of the new thumbnails take the place of the first old one
+			if !thumbnailsWritten {
+				err = writeThumbnails()
+			}
+		default:
+			err = out.copy(f)
+		}
+
+		if err != nil {
+			return fmt.Errorf("rewriting %s: %s", f.Name, err)
+		}
+	}
+
+	if e.Thumbnails != nil && !thumbnailsWritten {
+		err := writeThumbnails()
+		if err != nil {
+			return err
+		}
+	}
+
+	return out.Close()
+}
+
+// RewriteFile is Rewrite for a .makerbot file given a filepath. `src`
+// and `dst` can be the same file.
+func RewriteFile(src, dst string, e Edit) error {
+	rc, err := zip.OpenReader(src)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	return writeFileAtomic(dst, func(w io.Writer) error {
+		return Rewrite(rc, w, e)
+	})
+}
+
+func isThumbnail(name string) bool {
+	return strings.HasPrefix(name, "thumbnail_") && strings.HasSuffix(name, ".png")
+}
+
+// copy copies `f` without decompressing it
+func (w *Writer) copy(f *zip.File) error {
+	raw, err := f.OpenRaw()
+	if err != nil {
+		return err
+	}
+
+	header := f.FileHeader
+	dst, err := w.zw.CreateRaw(&header)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(dst, raw)
+	return err
+}
+
+func (w *Writer) rewriteMetadata(f *zip.File, edit func(*Metadata)) error {
+	fc, err := f.Open()
+	if err != nil {
+		return err
+	}
+
+	b, err := ioutil.ReadAll(fc)
+	fc.Close()
+	if err != nil {
+		return err
+	}
+
+	// Values that don't fit Metadata's types are left out of it, and
+	// since they are the same before and after the edit, they are kept
+	var m Metadata
+	err = json.Unmarshal(b, &m)
+	if _, ok := err.(*json.UnmarshalTypeError); err != nil && !ok {
+		return err
+	}
+
+	before, err := json.Marshal(&m)
+	if err != nil {
+		return err
+	}
+
+	edit(&m)
+
+	after, err := json.Marshal(&m)
+	if err != nil {
+		return err
+	}
+
+	merged, changed, err := mergeJSON(b, before, after)
+	if err != nil {
+		return err
+	}
+
+	if !changed {
+		return w.copy(f)
+	}
+
+	var indented bytes.Buffer
+	err = json.Indent(&indented, merged, "", "    ")
+	if err != nil {
+		return err
+	}
+	b = indented.Bytes()
+
+	header := f.FileHeader
+	dst, err := w.zw.CreateHeader(&header)
+	if err != nil {
+		return err
+	}
+
+	_, err = dst.Write(b)
+	return err
+}
+
+// mergeJSON applies the changes between `before` and `after` to
+// `orig`. Objects are merged key by key, so keys of `orig` that aren't
+// in `before` and `after`, or didn't change, keep their exact value.
+// Keys are sorted, like in the meta.json MakerBot Print writes.
+func mergeJSON(orig, before, after json.RawMessage) (json.RawMessage, bool, error) {
+	if bytes.Equal(before, after) {
+		return orig, false, nil
+	}
+
+	var o, b, a map[string]json.RawMessage
+	if json.Unmarshal(orig, &o) != nil || json.Unmarshal(before, &b) != nil || json.Unmarshal(after, &a) != nil || o == nil || a == nil {
+		// Not all objects; the new value replaces the old one
+		return after, true, nil
+	}
+
+	changed := false
+	for k, v := range a {
+		if ov, ok := o[k]; ok {
+			merged, c, err := mergeJSON(ov, b[k], v)
+			if err != nil {
+				return nil, false, err
+			}
+
+			o[k] = merged
+			changed = changed || c
+		} else if !bytes.Equal(b[k], v) {
+			o[k] = v
+			changed = true
+		}
+	}
+
+	if !changed {
+		return orig, false, nil
+	}
+
+	merged, err := json.Marshal(o)
+	return merged, true, err
+}
@@ -0,0 +1,393 @@
+package printfile_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/tjhorner/makerbot-rpc/printfile"
+)
+
+func tempDir(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "printfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+// rawEntries returns the compressed contents of every entry of a zip file
+func rawEntries(t *testing.T, filename string) map[string][]byte {
+	rc, err := zip.OpenReader(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+
+	entries := make(map[string][]byte)
+	for _, f := range rc.File {
+		r, err := f.OpenRaw()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		entries[f.Name], err = ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return entries
+}
+
+func readEntry(t *testing.T, filename, name string) []byte {
+	rc, err := zip.OpenReader(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+
+	for _, f := range rc.File {
+		if f.Name != name {
+			continue
+		}
+
+		r, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		b, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return b
+	}
+
+	t.Fatalf("%s has no %s", filename, name)
+	return nil
+}
+
+func topLevelKeys(t *testing.T, b []byte) map[string]json.RawMessage {
+	var keys map[string]json.RawMessage
+	if err := json.Unmarshal(b, &keys); err != nil {
+		t.Fatal(err)
+	}
+
+	for k, v := range keys {
+		var compact bytes.Buffer
+		json.Compact(&compact, v)
+		keys[k] = compact.Bytes()
+	}
+
+	return keys
+}
+
+func TestRewriteUnchanged(t *testing.T) {
+	dir, done := tempDir(t)
+	defer done()
+
+	out := filepath.Join(dir, "box.makerbot")
+	err := printfile.RewriteFile(file, out, printfile.Edit{Metadata: func(m *printfile.Metadata) {}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := rawEntries(t, file), rawEntries(t, out); !reflect.DeepEqual(want, got) {
+		t.Error("entries of a file rewritten without changes are different")
+	}
+}
+
+func TestThumbnailData(t *testing.T) {
+	thumbnails, err := printfile.GetFileThumbnails(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, th := range *thumbnails {
+		img, err := png.Decode(bytes.NewReader(th.Data))
+		if err != nil {
+			t.Fatalf("thumbnail %dx%d: %s", th.TargetWidth, th.TargetHeight, err)
+		}
+
+		if img.Bounds().Dx() != th.ActualWidth {
+			t.Errorf("thumbnail is %d wide, wanted %d", img.Bounds().Dx(), th.ActualWidth)
+		}
+	}
+}
+
+func TestRewriteMetadataAndThumbnails(t *testing.T) {
+	dir, done := tempDir(t)
+	defer done()
+
+	var thumb bytes.Buffer
+	png.Encode(&thumb, image.NewRGBA(image.Rect(0, 0, 20, 10)))
+
+	out := filepath.Join(dir, "box.makerbot")
+	err := printfile.RewriteFile(file, out, printfile.Edit{
+		Metadata: func(m *printfile.Metadata) {
+			m.ExtruderTemperature = 220
+			m.MachineConfig.Version = "1.2.0"
+		},
+		Thumbnails: []printfile.Thumbnail{{Data: thumb.Bytes()}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := printfile.ParseFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if parsed.Metadata.ExtruderTemperature != 220 || parsed.Metadata.MachineConfig.Version != "1.2.0" {
+		t.Errorf("metadata was not edited: %d, %s", parsed.Metadata.ExtruderTemperature, parsed.Metadata.MachineConfig.Version)
+	}
+
+	if n := len(*parsed.ThumbnailSizes); n != 1 || (*parsed.ThumbnailSizes)[0].TargetWidth != 20 {
+		t.Errorf("got %d thumbnails, wanted the new 20x10 one", n)
+	}
+
+	// Only the edited keys changed, and everything else is the same
+	before := topLevelKeys(t, readEntry(t, file, "meta.json"))
+	after := topLevelKeys(t, readEntry(t, out, "meta.json"))
+
+	if len(before) != len(after) {
+		t.Errorf("meta.json went from %d to %d keys", len(before), len(after))
+	}
+
+	for k, v := range before {
+		changed := !bytes.Equal(v, after[k])
+		if changed != (k == "extruder_temperature" || k == "machine_config") {
+			t.Errorf("key %s: changed is %t", k, changed)
+		}
+	}
+
+	var machineBefore, machineAfter map[string]interface{}
+	json.Unmarshal(before["machine_config"], &machineBefore)
+	json.Unmarshal(after["machine_config"], &machineAfter)
+	machineBefore["version"] = "1.2.0"
+	if !reflect.DeepEqual(machineBefore, machineAfter) {
+		t.Error("machine_config changed more than its version")
+	}
+
+	want, got := rawEntries(t, file), rawEntries(t, out)
+	if !bytes.Equal(want["print.jsontoolpath"], got["print.jsontoolpath"]) {
+		t.Error("toolpath was not copied byte-for-byte")
+	}
+}
+
+func TestRewriteKeepsUnknownKeys(t *testing.T) {
+	dir, done := tempDir(t)
+	defer done()
+
+	meta := `{"bot_type": "replicator_b", "custom": {"b":1,  "a":[1.50]}, "bounding_box": {"x_max": 1.0, "mystery": "yes"}}`
+
+	src := filepath.Join(dir, "src.makerbot")
+	f, err := os.Create(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	zw := zip.NewWriter(f)
+	w, _ := zw.Create("meta.json")
+	w.Write([]byte(meta))
+	w, _ = zw.Create("extra/unknown.bin")
+	w.Write([]byte{0, 1, 2, 3})
+	zw.Close()
+	f.Close()
+
+	err = printfile.RewriteFile(src, src, printfile.Edit{Metadata: func(m *printfile.Metadata) {
+		m.BoundingBox.XMin = -1
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got map[string]json.RawMessage
+	json.Unmarshal(readEntry(t, src, "meta.json"), &got)
+
+	var compact bytes.Buffer
+	json.Compact(&compact, got["custom"])
+	if compact.String() != `{"b":1,"a":[1.50]}` {
+		t.Errorf("custom key is %s", compact.String())
+	}
+
+	var bb map[string]interface{}
+	json.Unmarshal(got["bounding_box"], &bb)
+	if bb["mystery"] != "yes" || bb["x_min"] != -1.0 || bb["x_max"] != 1.0 {
+		t.Errorf("bounding_box is %v", bb)
+	}
+
+	if !bytes.Equal(readEntry(t, src, "extra/unknown.bin"), []byte{0, 1, 2, 3}) {
+		t.Error("unknown entry was not kept")
+	}
+}
+
+func TestRewriteKeepsPermissions(t *testing.T) {
+	dir, done := tempDir(t)
+	defer done()
+
+	out := filepath.Join(dir, "new.makerbot")
+	err := printfile.RewriteFile(file, out, printfile.Edit{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fi, err := os.Stat(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if fi.Mode().Perm() != 0644 {
+		t.Errorf("new file has mode %v, wanted 0644", fi.Mode().Perm())
+	}
+
+	// Rewriting a file in place keeps its mode
+	err = os.Chmod(out, 0640)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = printfile.RewriteFile(out, out, printfile.Edit{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fi, err = os.Stat(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if fi.Mode().Perm() != 0640 {
+		t.Errorf("rewritten file has mode %v, wanted 0640", fi.Mode().Perm())
+	}
+}
+
+func TestWriteFile(t *testing.T) {
+	dir, done := tempDir(t)
+	defer done()
+
+	orig, err := printfile.ParseFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tr, err := printfile.OpenFileToolpath(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tr.Close()
+
+	out := filepath.Join(dir, "new.makerbot")
+	err = printfile.WriteFile(out, orig.Metadata, tr, *orig.ThumbnailSizes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := printfile.ParseFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(orig.Metadata, parsed.Metadata) {
+		t.Error("metadata is different after writing it")
+	}
+
+	if !reflect.DeepEqual(orig.ThumbnailSizes, parsed.ThumbnailSizes) {
+		t.Error("thumbnails are different after writing them")
+	}
+
+	if !reflect.DeepEqual(orig.Toolpath, parsed.Toolpath) {
+		t.Error("toolpath is different after writing it")
+	}
+
+	// The toolpath is the same JSON, down to the parameters that
+	// ToolpathParameters doesn't have fields for
+	var want, got []interface{}
+	json.Unmarshal(readEntry(t, file, "print.jsontoolpath"), &want)
+	json.Unmarshal(readEntry(t, out, "print.jsontoolpath"), &got)
+
+	if len(want) != expectedToolpathCommands || !reflect.DeepEqual(want, got) {
+		t.Error("toolpath JSON is different after writing it")
+	}
+}
+
+func TestToolpathCommandJSON(t *testing.T) {
+	for _, tt := range []struct {
+		in, out string
+	}{
+		{
+			`{"function":"toggle_fan","metadata":{},"parameters":{"index":0,"value":false,"speed":"fast"},"tags":[]}`,
+			`{"function":"toggle_fan","metadata":{},"parameters":{"index":0,"value":false,"speed":"fast"},"tags":[]}`,
+		},
+		{
+			`{"function":"mystery","metadata":{},"parameters":{},"tags":["A"]}`,
+			`{"function":"mystery","metadata":{},"parameters":{},"tags":["A"]}`,
+		},
+		{
+			// Keys of nested objects aren't parameters
+			`{"function":"move","metadata":{"relative":{"a":false,"x":false,"y":false,"z":false}},"parameters":{"x":1,"b":{"y":2,"c":[{"z":"3,\"a\""}]}},"tags":[]}`,
+			`{"function":"move","metadata":{"relative":{"a":false,"x":false,"y":false,"z":false}},"parameters":{"x":1,"b":{"y":2,"c":[{"z":"3,\"a\""}]}},"tags":[]}`,
+		},
+		{
+			`{"function":"delay","metadata":{},"parameters":{"\u0073econds":2},"tags":[]}`,
+			`{"function":"delay","metadata":{},"parameters":{"seconds":2},"tags":[]}`,
+		},
+	} {
+		var cmd printfile.ToolpathCommand
+		if err := json.Unmarshal([]byte(tt.in), &cmd); err != nil {
+			t.Fatal(err)
+		}
+
+		b, err := json.Marshal(cmd)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(b) != tt.out {
+			t.Errorf("got %s, wanted %s", b, tt.out)
+		}
+	}
+
+	// Commands that weren't read from JSON get the usual parameters
+	var cmd printfile.ToolpathCommand
+	cmd.Function = "set_toolhead_temperature"
+	cmd.Parameters.Temperature = 215
+
+	b, _ := json.Marshal(cmd)
+	if want := `{"function":"set_toolhead_temperature","metadata":{},"parameters":{"index":0,"temperature":215},"tags":[]}`; string(b) != want {
+		t.Errorf("got %s, wanted %s", b, want)
+	}
+
+	// and unknown commands the ones that aren't zero
+	cmd = printfile.ToolpathCommand{Function: "mystery"}
+	cmd.Parameters.Comment = "hi"
+	cmd.Parameters.Value = false
+
+	b, _ = json.Marshal(cmd)
+	if want := `{"function":"mystery","metadata":{},"parameters":{"comment":"hi","value":false},"tags":[]}`; string(b) != want {
+		t.Errorf("got %s, wanted %s", b, want)
+	}
+
+	// Fields set on a parsed command are written even if their key wasn't read
+	cmd = printfile.ToolpathCommand{}
+	if err := json.Unmarshal([]byte(`{"function":"move","metadata":{},"parameters":{"x":1},"tags":[]}`), &cmd); err != nil {
+		t.Fatal(err)
+	}
+	cmd.Parameters.FeedRate = 40
+
+	b, _ = json.Marshal(cmd)
+	if want := `{"function":"move","metadata":{"relative":{"a":false,"x":false,"y":false,"z":false}},"parameters":{"feedrate":40,"x":1},"tags":[]}`; string(b) != want {
+		t.Errorf("got %s, wanted %s", b, want)
+	}
+}
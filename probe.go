@@ -0,0 +1,125 @@
+package makerbot
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// ProbeOptions configures DiscoverAndProbe
+type ProbeOptions struct {
+	DiscoveryTimeout time.Duration // How long to listen for printers (default 3 seconds)
+	Concurrency      int           // How many printers to probe at once (default 8)
+}
+
+// ProbeResult is a printer found by DiscoverAndProbe
+type ProbeResult struct {
+	Printer Printer // The printer, with the fields from its handshake filled in if probing succeeded
+	Err     error   // Why the printer couldn't be probed, if it couldn't
+}
+
+// DiscoverAndProbe discovers printers with DiscoverPrinters, then
+// connects to each of them to perform the (unauthenticated) handshake,
+// which fills in the fields that discovery leaves out (FirmwareVersion,
+// MachineType, etc.). Connections are closed right after.
+//
+// Printers that could not be probed are still returned, with the fields
+// from discovery and the error. If `ctx` is done before every printer is
+// probed, the remaining ones fail with the context's error.
+func DiscoverAndProbe(ctx context.Context, opts ...ProbeOptions) ([]ProbeResult, error) {
+	var o ProbeOptions
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+
+	if o.DiscoveryTimeout <= 0 {
+		o.DiscoveryTimeout = 3 * time.Second
+	}
+
+	if o.Concurrency <= 0 {
+		o.Concurrency = 8
+	}
+
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < o.DiscoveryTimeout {
+		o.DiscoveryTimeout = time.Until(deadline)
+	}
+
+	printers, err := DiscoverPrinters(o.DiscoveryTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]ProbeResult, len(*printers))
+	sem := make(chan struct{}, o.Concurrency)
+
+	var wg sync.WaitGroup
+	for i, p := range *printers {
+		wg.Add(1)
+
+		go func(i int, p Printer) {
+			defer wg.Done()
+
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+			case <-ctx.Done():
+				results[i] = ProbeResult{p, ctx.Err()}
+				return
+			}
+
+			probed, err := ProbePrinter(ctx, p)
+			if err != nil {
+				results[i] = ProbeResult{p, err}
+				return
+			}
+
+			results[i] = ProbeResult{Printer: *probed}
+		}(i, p)
+	}
+
+	wg.Wait()
+
+	return results, nil
+}
+
+// ProbePrinter connects to `p`, performs the handshake and disconnects.
+// The returned Printer has the fields from the handshake, and the fields
+// the handshake didn't include are taken from `p`.
+//
+// If `ctx` is done first, the connection is closed and the context's
+// error is returned.
+func ProbePrinter(ctx context.Context, p Printer) (*Printer, error) {
+	c := NewClient()
+	c.IP = p.IP
+	c.Port = p.Port
+
+	err := c.connectRPCContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+
+	// Closing the connection makes the handshake give up
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			c.Close()
+		case <-done:
+		}
+	}()
+
+	printer, err := c.sendHandshake()
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	fillPrinter(printer, &p)
+	return printer, nil
+}
@@ -0,0 +1,75 @@
+package makerbot
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestProbePrinter(t *testing.T) {
+	p := newFakePrinter(t)
+	defer p.Close()
+
+	host, port, _ := net.SplitHostPort(p.l.Addr().String())
+
+	probed, err := ProbePrinter(context.Background(), Printer{IP: host, Port: port, Serial: "23C1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if probed.MachineName != "Fake Bot" || probed.FirmwareVersion.Major != 2 {
+		t.Errorf("handshake fields are missing: %+v", probed)
+	}
+
+	if probed.Serial != "23C1" || probed.IP != host {
+		t.Errorf("discovery fields are missing: %+v", probed)
+	}
+}
+
+func TestProbePrinterCancelled(t *testing.T) {
+	// A printer that accepts connections but never answers
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	closed := make(chan struct{})
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		b := make([]byte, 512)
+		for {
+			if _, err := conn.Read(b); err != nil {
+				close(closed)
+				return
+			}
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	host, port, _ := net.SplitHostPort(l.Addr().String())
+
+	start := time.Now()
+	_, err = ProbePrinter(ctx, Printer{IP: host, Port: port})
+	if err != context.DeadlineExceeded {
+		t.Errorf("got %v, wanted %v", err, context.DeadlineExceeded)
+	}
+
+	if time.Since(start) > time.Second {
+		t.Errorf("probe took %s to give up", time.Since(start))
+	}
+
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Error("connection was left open")
+	}
+}
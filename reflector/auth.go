@@ -0,0 +1,305 @@
+package reflector
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+)
+
+// Defaults for OAuthConfig. These are unverified guesses: they have not
+// been checked against Reflector, so if Login fails, set the values
+// MakerBot's own software uses in Client.OAuth.
+const (
+	DefaultTokenPath    = "/oauth/token"
+	DefaultClientID     = "MakerWare"
+	DefaultClientSecret = "secret"
+)
+
+const (
+	// Tokens are refreshed this long before they expire, so that a
+	// request never goes out with a token that expires on the way
+	refreshMargin = time.Minute
+)
+
+// OAuthConfig identifies the Client to Reflector's token endpoint. Empty
+// fields take the Default* values.
+type OAuthConfig struct {
+	TokenPath    string // Path of the token endpoint, relative to BaseURL
+	ClientID     string
+	ClientSecret string
+}
+
+// ErrNotLoggedIn is returned when a request needs an access token and
+// the Client doesn't have one
+var ErrNotLoggedIn = errors.New("reflector: not logged in")
+
+// Token is a MakerBot account access token along with what's needed
+// to refresh it
+type Token struct {
+	AccessToken  string    `json:"access_token"`
+	RefreshToken string    `json:"refresh_token,omitempty"`
+	Expiry       time.Time `json:"expiry,omitempty"` // Zero if the token doesn't expire (or we don't know when)
+}
+
+// expired reports whether the token expires within `margin` of `now`
+func (t *Token) expired(now time.Time, margin time.Duration) bool {
+	return !t.Expiry.IsZero() && now.Add(margin).After(t.Expiry)
+}
+
+func staticToken(accessToken string) *Token {
+	if accessToken == "" {
+		return nil
+	}
+
+	return &Token{AccessToken: accessToken}
+}
+
+// TokenStore persists a Client's tokens, e.g. between runs of a program
+type TokenStore interface {
+	// Load returns the saved token, or nil if there is none
+	Load() (*Token, error)
+	// Save replaces the saved token with `t`
+	Save(t *Token) error
+}
+
+// FileTokenStore is a TokenStore that keeps the token in a JSON file.
+// The file is only readable by its owner since it holds credentials.
+type FileTokenStore string
+
+// Load implements TokenStore
+func (path FileTokenStore) Load() (*Token, error) {
+	b, err := ioutil.ReadFile(string(path))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	var t Token
+	err = json.Unmarshal(b, &t)
+	if err != nil {
+		return nil, err
+	}
+
+	return &t, nil
+}
+
+// Save implements TokenStore
+func (path FileTokenStore) Save(t *Token) error {
+	b, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(string(path), b, 0600)
+}
+
+// MemoryTokenStore is a TokenStore that keeps the token in memory,
+// which is mostly useful for tests
+type MemoryTokenStore struct {
+	token *Token
+	mux   sync.Mutex
+}
+
+// Load implements TokenStore
+func (s *MemoryTokenStore) Load() (*Token, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	return s.token, nil
+}
+
+// Save implements TokenStore
+func (s *MemoryTokenStore) Save(t *Token) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	s.token = t
+	return nil
+}
+
+// tokenSource is shared by copies of a Client so that they all see
+// refreshed tokens
+type tokenSource struct {
+	token      *Token
+	store      TokenStore
+	mux        sync.Mutex // protects token and store
+	refreshMux sync.Mutex // held while refreshing, so that only one request does it
+}
+
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"`
+}
+
+// SetTokenStore makes the Client persist its tokens to `store`. If
+// `store` already holds a token, the Client starts using it.
+func (c *Client) SetTokenStore(store TokenStore) error {
+	t, err := store.Load()
+	if err != nil {
+		return err
+	}
+
+	c.tokens.mux.Lock()
+	defer c.tokens.mux.Unlock()
+
+	c.tokens.store = store
+	if t != nil {
+		c.tokens.token = t
+	}
+
+	return nil
+}
+
+// LoggedIn reports whether the Client has an access token
+func (c *Client) LoggedIn() bool {
+	c.tokens.mux.Lock()
+	defer c.tokens.mux.Unlock()
+
+	return c.tokens.token != nil
+}
+
+// Token returns the Client's current token, or nil if it has none
+func (c *Client) Token() *Token {
+	c.tokens.mux.Lock()
+	defer c.tokens.mux.Unlock()
+
+	if c.tokens.token == nil {
+		return nil
+	}
+
+	t := *c.tokens.token
+	return &t
+}
+
+// Login trades MakerBot account credentials for an access token and a
+// refresh token, which the Client then uses for its requests and saves
+// to its TokenStore, if it has one.
+func (c *Client) Login(username, password string) (*Token, error) {
+	return c.requestToken(url.Values{
+		"grant_type": {"password"},
+		"username":   {username},
+		"password":   {password},
+	})
+}
+
+// Refresh gets a new access token with the refresh token. You don't
+// usually need to call it, since tokens are refreshed before they
+// expire and when Reflector rejects them.
+func (c *Client) Refresh() (*Token, error) {
+	c.tokens.refreshMux.Lock()
+	defer c.tokens.refreshMux.Unlock()
+
+	return c.refresh(c.Token())
+}
+
+// refresh must be called with c.tokens.refreshMux held
+func (c *Client) refresh(t *Token) (*Token, error) {
+	if t == nil || t.RefreshToken == "" {
+		return nil, errors.New("reflector: no refresh token")
+	}
+
+	return c.requestToken(url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {t.RefreshToken},
+	})
+}
+
+// refreshStale refreshes the token if its access token is still
+// `accessToken`. If another request has refreshed it in the meantime,
+// that token is used instead.
+func (c *Client) refreshStale(accessToken string) (*Token, error) {
+	c.tokens.refreshMux.Lock()
+	defer c.tokens.refreshMux.Unlock()
+
+	t := c.Token()
+	if t == nil {
+		return nil, ErrNotLoggedIn
+	}
+
+	if t.AccessToken != accessToken {
+		return t, nil
+	}
+
+	return c.refresh(t)
+}
+
+func (c *Client) requestToken(form url.Values) (*Token, error) {
+	tokenPath, clientID, clientSecret := c.OAuth.TokenPath, c.OAuth.ClientID, c.OAuth.ClientSecret
+	if tokenPath == "" {
+		tokenPath = DefaultTokenPath
+	}
+
+	if clientID == "" {
+		clientID = DefaultClientID
+	}
+
+	if clientSecret == "" {
+		clientSecret = DefaultClientSecret
+	}
+
+	form.Set("client_id", clientID)
+	form.Set("client_secret", clientSecret)
+
+	var res tokenResponse
+	err := c.do("POST", tokenPath, form, &res, false)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.AccessToken == "" {
+		return nil, errors.New("reflector: no access token in response")
+	}
+
+	t := &Token{AccessToken: res.AccessToken, RefreshToken: res.RefreshToken}
+	if res.ExpiresIn > 0 {
+		t.Expiry = time.Now().Add(time.Duration(res.ExpiresIn) * time.Second)
+	}
+
+	c.tokens.mux.Lock()
+	defer c.tokens.mux.Unlock()
+
+	// Some servers only send a new refresh token when the old one changes
+	if t.RefreshToken == "" && c.tokens.token != nil {
+		t.RefreshToken = c.tokens.token.RefreshToken
+	}
+
+	c.tokens.token = t
+
+	if c.tokens.store != nil {
+		err = c.tokens.store.Save(t)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	saved := *t
+	return &saved, nil
+}
+
+// accessToken returns an access token for a request, refreshing it
+// first if it is about to expire
+func (c *Client) accessToken() (string, error) {
+	t := c.Token()
+	if t == nil {
+		return "", ErrNotLoggedIn
+	}
+
+	if t.expired(time.Now(), refreshMargin) && t.RefreshToken != "" {
+		t, err := c.refreshStale(t.AccessToken)
+		if err != nil {
+			return "", err
+		}
+
+		return t.AccessToken, nil
+	}
+
+	return t.AccessToken, nil
+}
@@ -0,0 +1,241 @@
+package reflector
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// tokenServer is a stub of the token endpoint that hands out
+// numbered tokens
+func tokenServer(t *testing.T, expiresIn int) (*Client, *int, func()) {
+	issued := 0
+
+	c, done := testClient(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case DefaultTokenPath:
+			switch r.FormValue("grant_type") {
+			case "password":
+				if r.FormValue("username") != "user" || r.FormValue("password") != "pass" {
+					w.WriteHeader(http.StatusUnauthorized)
+					w.Write([]byte(`{"error":"invalid_grant"}`))
+					return
+				}
+			case "refresh_token":
+				if r.FormValue("refresh_token") != "refresh" {
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+			default:
+				t.Errorf("unexpected grant_type %q", r.FormValue("grant_type"))
+			}
+
+			issued++
+			fmt.Fprintf(w, `{"access_token":"access%d","refresh_token":"refresh","expires_in":%d}`, issued, expiresIn)
+		case "/printers":
+			w.Write([]byte(`{"printers":[{"id":"` + r.Header.Get("Authorization") + `"}]}`))
+		}
+	})
+
+	return c, &issued, done
+}
+
+func TestLogin(t *testing.T) {
+	c, _, done := tokenServer(t, 3600)
+	defer done()
+
+	c.tokens.token = nil
+	if _, err := c.GetPrinters(); err != ErrNotLoggedIn {
+		t.Fatalf("got error %v before logging in, want ErrNotLoggedIn", err)
+	}
+
+	if _, err := c.Login("user", "wrong"); err == nil {
+		t.Fatal("expected an error with the wrong password")
+	}
+
+	token, err := c.Login("user", "pass")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if token.AccessToken != "access1" || token.RefreshToken != "refresh" || token.Expiry.IsZero() {
+		t.Errorf("unexpected token %+v", token)
+	}
+
+	printers, err := c.GetPrinters()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if printers[0].ID != "Bearer access1" {
+		t.Errorf("request was sent with %q", printers[0].ID)
+	}
+}
+
+func TestRefreshBeforeExpiry(t *testing.T) {
+	// Tokens expire in less than refreshMargin, so every request refreshes
+	c, issued, done := tokenServer(t, 5)
+	defer done()
+
+	store := &MemoryTokenStore{}
+	if err := c.SetTokenStore(store); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.Login("user", "pass"); err != nil {
+		t.Fatal(err)
+	}
+
+	printers, err := c.GetPrinters()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if *issued != 2 || printers[0].ID != "Bearer access2" {
+		t.Errorf("got %d tokens issued and request sent with %q", *issued, printers[0].ID)
+	}
+
+	saved, _ := store.Load()
+	if saved == nil || saved.AccessToken != "access2" {
+		t.Errorf("store holds %+v, want the refreshed token", saved)
+	}
+}
+
+func TestFileTokenStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "reflector")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store := FileTokenStore(filepath.Join(dir, "token.json"))
+
+	token, err := store.Load()
+	if err != nil || token != nil {
+		t.Fatalf("got %+v, %v from an empty store", token, err)
+	}
+
+	expiry := time.Now().Add(time.Hour).Round(time.Second)
+	err = store.Save(&Token{AccessToken: "a", RefreshToken: "r", Expiry: expiry})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewClient("")
+	if err := c.SetTokenStore(store); err != nil {
+		t.Fatal(err)
+	}
+
+	token = c.Token()
+	if token == nil || token.AccessToken != "a" || !token.Expiry.Equal(expiry) {
+		t.Errorf("loaded %+v", token)
+	}
+}
+
+func TestRefreshOnUnauthorized(t *testing.T) {
+	issued, requests := 0, 0
+
+	c, done := testClient(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case DefaultTokenPath:
+			issued++
+			fmt.Fprintf(w, `{"access_token":"access%d","refresh_token":"refresh","expires_in":3600}`, issued)
+		case "/printers":
+			requests++
+
+			// The first token is revoked before it expires
+			if r.Header.Get("Authorization") != "Bearer access2" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+
+			w.Write([]byte(`{"printers":[]}`))
+		}
+	})
+	defer done()
+
+	if _, err := c.Login("user", "pass"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.GetPrinters(); err != nil {
+		t.Fatal(err)
+	}
+
+	if issued != 2 || requests != 2 {
+		t.Errorf("got %d tokens issued and %d requests, want 2 and 2", issued, requests)
+	}
+
+	// Without a refresh token, the 401 is returned as is
+	*c.tokens = tokenSource{token: staticToken("static")}
+	requests = 0
+
+	_, err := c.GetPrinters()
+	if e, ok := err.(*Error); !ok || e.StatusCode != http.StatusUnauthorized {
+		t.Errorf("got error %v, want a 401", err)
+	}
+
+	if issued != 2 || requests != 1 {
+		t.Errorf("got %d tokens issued and %d requests, want 2 and 1", issued, requests)
+	}
+}
+
+func TestOAuthConfig(t *testing.T) {
+	c, done := testClient(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/token" || r.FormValue("client_id") != "id" || r.FormValue("client_secret") != "shh" {
+			t.Errorf("token request to %s with client %q/%q", r.URL.Path, r.FormValue("client_id"), r.FormValue("client_secret"))
+		}
+
+		w.Write([]byte(`{"access_token":"access"}`))
+	})
+	defer done()
+
+	c.OAuth = OAuthConfig{TokenPath: "/token", ClientID: "id", ClientSecret: "shh"}
+
+	if _, err := c.Login("user", "pass"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoginDoesNotBlockToken(t *testing.T) {
+	reached, release := make(chan struct{}), make(chan struct{})
+
+	c, done := testClient(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case reached <- struct{}{}:
+			<-release
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			w.Write([]byte(`{"access_token":"access"}`))
+		}
+	})
+	defer done()
+
+	c.tokens.token = nil
+	result := make(chan error, 1)
+	go func() {
+		_, err := c.Login("user", "pass")
+		result <- err
+	}()
+
+	<-reached
+
+	// Login is waiting for Reflector, which must not keep others from
+	// looking at the token
+	if c.LoggedIn() {
+		t.Error("logged in before Login finished")
+	}
+	close(release)
+
+	if err := <-result; err != nil {
+		t.Fatal(err)
+	}
+
+	if !c.LoggedIn() {
+		t.Error("not logged in after Login")
+	}
+}
@@ -3,98 +3,169 @@ package reflector
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // Client is an HTTP client that talks to MakerBot Reflector.
 type Client struct {
-	BaseURL     string
-	accessToken string
-	http        *http.Client
+	BaseURL      string
+	MaxRetries   int           // How many times requests are retried when Reflector returns a 5xx status
+	RetryBackoff time.Duration // Delay before the first retry, doubled for every following one
+	OAuth        OAuthConfig   // Used by Login and to refresh tokens
+	tokens       *tokenSource
+	http         *http.Client
 }
 
 func (c *Client) url(endpoint string) string {
 	return fmt.Sprintf("%s%s", c.BaseURL, endpoint)
 }
 
-func (c *Client) httpGet(endpoint string) (*json.RawMessage, error) {
-	req, err := http.NewRequest("GET", c.url(endpoint), nil)
-	if err != nil {
-		return nil, err
+// do performs a request and decodes the JSON response into `v`. If
+// `authed` is true, the request carries the access token, which is
+// refreshed first if needed, and refreshed once more if Reflector
+// rejects it. Requests that fail with a 5xx status or a network error
+// are retried up to MaxRetries times.
+func (c *Client) do(method, endpoint string, form url.Values, v interface{}, authed bool) error {
+	token, err := c.doRetrying(method, endpoint, form, v, authed)
+
+	// The token may have been revoked or have expired early
+	if e, ok := err.(*Error); ok && authed && e.StatusCode == http.StatusUnauthorized {
+		_, rerr := c.refreshStale(token)
+		if rerr == nil {
+			_, err = c.doRetrying(method, endpoint, form, v, authed)
+		}
 	}
 
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.accessToken))
-
-	r, err := c.http.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer r.Body.Close()
+	return err
+}
 
-	resp, err := ioutil.ReadAll(r.Body)
-	if err != nil {
-		return nil, err
+// doRetrying is do without the refresh on a 401. It returns the access
+// token the last attempt was sent with.
+func (c *Client) doRetrying(method, endpoint string, form url.Values, v interface{}, authed bool) (string, error) {
+	var (
+		token string
+		err   error
+	)
+
+	for attempt := 0; attempt <= c.MaxRetries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(c.RetryBackoff * time.Duration(1<<uint(attempt-1)))
+		}
+
+		if authed {
+			token, err = c.accessToken()
+			if err != nil {
+				return "", err
+			}
+		}
+
+		var retry bool
+		retry, err = c.doOnce(method, endpoint, form, v, token)
+		if !retry {
+			return token, err
+		}
 	}
 
-	jr := json.RawMessage(resp)
-
-	return &jr, nil
+	return token, err
 }
 
-func (c *Client) httpPost(endpoint string, params map[string]string) (*json.RawMessage, error) {
-	data := url.Values{}
-	for k, v := range params {
-		data.Set(k, v)
+// doOnce sends a single request, with `token` as its bearer token
+// unless it is empty
+func (c *Client) doOnce(method, endpoint string, form url.Values, v interface{}, token string) (bool, error) {
+	var body io.Reader
+	if form != nil {
+		body = strings.NewReader(form.Encode())
 	}
 
-	req, err := http.NewRequest("POST", c.url(endpoint), strings.NewReader(data.Encode()))
+	req, err := http.NewRequest(method, c.url(endpoint), body)
 	if err != nil {
-		return nil, err
+		return false, err
 	}
 
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.accessToken))
-	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
-	req.Header.Add("Content-Length", strconv.Itoa(len(data.Encode())))
+	if token != "" {
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+	}
+
+	if form != nil {
+		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Add("Content-Length", strconv.Itoa(len(form.Encode())))
+	}
 
 	r, err := c.http.Do(req)
 	if err != nil {
-		return nil, err
+		return true, err
 	}
 	defer r.Body.Close()
 
 	resp, err := ioutil.ReadAll(r.Body)
 	if err != nil {
-		return nil, err
+		return true, err
 	}
 
-	jr := json.RawMessage(resp)
+	if r.StatusCode < 200 || r.StatusCode > 299 {
+		return r.StatusCode >= 500, newError(r.StatusCode, r.Header, resp)
+	}
+
+	if v == nil {
+		return false, nil
+	}
+
+	err = json.Unmarshal(resp, v)
+	if err != nil {
+		return false, fmt.Errorf("could not decode Reflector response: %s", err)
+	}
+
+	return false, nil
+}
+
+func (c *Client) httpGet(endpoint string, v interface{}) error {
+	return c.do("GET", endpoint, nil, v, true)
+}
+
+func (c *Client) httpPost(endpoint string, params map[string]string, v interface{}) error {
+	data := url.Values{}
+	for k, v := range params {
+		data.Set(k, v)
+	}
 
-	return &jr, nil
+	return c.do("POST", endpoint, data, v, true)
 }
 
 // GetPrinters gets a list of printers connected to the Thingiverse account
-func (c *Client) GetPrinters() (*json.RawMessage, error) {
-	return c.httpGet("/printers")
+func (c *Client) GetPrinters() ([]Printer, error) {
+	var res printersResponse
+	err := c.httpGet("/printers", &res)
+	return res.Printers, err
 }
 
 // GetPrinter gets a printer with `id`
-func (c *Client) GetPrinter(id string) (*json.RawMessage, error) {
-	return c.httpGet(fmt.Sprintf("/printers/%s", id))
+func (c *Client) GetPrinter(id string) (*Printer, error) {
+	var res printerResponse
+	err := c.httpGet(fmt.Sprintf("/printers/%s", url.PathEscape(id)), &res)
+	if err != nil {
+		return nil, err
+	}
+
+	return &res.Printer, nil
 }
 
 // CallPrinter returns a relay on which you can attach a makerbot.Client
 func (c *Client) CallPrinter(id string) (*CallPrinterResponse, error) {
-	resp, err := c.httpPost("/call", map[string]string{"printer_id": id})
+	var res CallPrinterResponse
+	err := c.httpPost("/call", map[string]string{"printer_id": id}, &res)
 	if err != nil {
 		return nil, err
 	}
 
-	var res CallPrinterResponse
-	json.Unmarshal(*resp, &res)
+	if res.Call.Relay == "" || res.Call.ID == "" {
+		return nil, fmt.Errorf("Reflector did not return a relay for printer %s", id)
+	}
 
 	return &res, nil
 }
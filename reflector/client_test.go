@@ -0,0 +1,146 @@
+package reflector
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func testClient(h http.HandlerFunc) (*Client, func()) {
+	srv := httptest.NewServer(h)
+	c := NewClientWithBaseURL("token", srv.URL)
+	c.RetryBackoff = time.Millisecond
+	return &c, srv.Close
+}
+
+func TestGetPrinters(t *testing.T) {
+	for _, body := range []string{
+		`[{"id":"abc","iserial":"23C1","machine_name":"Bot","online":true,"status":{"state":"printing","step":"printing","progress":42}}]`,
+		`{"printers":[{"id":"abc","iserial":"23C1","machine_name":"Bot","online":true,"status":{"state":"printing","step":"printing","progress":42}}]}`,
+	} {
+		body := body
+		c, done := testClient(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "Bearer token" {
+				t.Errorf("unexpected Authorization header %q", r.Header.Get("Authorization"))
+			}
+
+			w.Write([]byte(body))
+		})
+
+		printers, err := c.GetPrinters()
+		done()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(printers) != 1 {
+			t.Fatalf("got %d printers, want 1", len(printers))
+		}
+
+		p := printers[0]
+		if p.ID != "abc" || p.Serial != "23C1" || !p.Online || p.Status == nil || *p.Status.Progress != 42 {
+			t.Errorf("unexpected printer %+v", p)
+		}
+	}
+}
+
+func TestGetPrinter(t *testing.T) {
+	c, done := testClient(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/printers/abc" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+
+		w.Write([]byte(`{"printer":{"id":"abc","machine_name":"Bot"}}`))
+	})
+	defer done()
+
+	p, err := c.GetPrinter("abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if p.MachineName != "Bot" {
+		t.Errorf("got machine name %q, want Bot", p.MachineName)
+	}
+}
+
+func TestErrorStatus(t *testing.T) {
+	calls := 0
+	c, done := testClient(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"error":"not_found","message":"no such printer"}`))
+	})
+	defer done()
+
+	_, err := c.CallPrinter("abc")
+	rerr, ok := err.(*Error)
+	if !ok {
+		t.Fatalf("got error %v, want *Error", err)
+	}
+
+	if rerr.StatusCode != http.StatusNotFound || rerr.Message != "no such printer" {
+		t.Errorf("unexpected error %+v", rerr)
+	}
+
+	if calls != 1 {
+		t.Errorf("4xx response was requested %d times, want 1", calls)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	calls := 0
+	c, done := testClient(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+
+		if r.FormValue("printer_id") != "abc" {
+			t.Errorf("got printer_id %q on retry, want abc", r.FormValue("printer_id"))
+		}
+
+		w.Write([]byte(`{"call":{"id":"1","relay":"127.0.0.1:1234","client_code":"code"}}`))
+	})
+	defer done()
+
+	res, err := c.CallPrinter("abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if calls != 3 || res.Call.ClientCode != "code" {
+		t.Errorf("got %d calls and response %+v", calls, res)
+	}
+}
+
+func TestRetryGivesUp(t *testing.T) {
+	calls := 0
+	c, done := testClient(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	defer done()
+
+	_, err := c.GetPrinters()
+	if rerr, ok := err.(*Error); !ok || rerr.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("got error %v, want HTTP 503", err)
+	}
+
+	if calls != c.MaxRetries+1 {
+		t.Errorf("got %d calls, want %d", calls, c.MaxRetries+1)
+	}
+}
+
+func TestCallPrinterWithoutRelay(t *testing.T) {
+	c, done := testClient(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"call":{}}`))
+	})
+	defer done()
+
+	if _, err := c.CallPrinter("abc"); err == nil {
+		t.Error("expected an error for a call without a relay")
+	}
+}
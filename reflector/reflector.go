@@ -1,24 +1,26 @@
 // Package reflector is a Go client library for the MakerBot Reflector API.
 package reflector
 
-import "net/http"
+import (
+	"net/http"
+	"time"
+)
 
 // NewClient returns a Client with the specified access
-// token
+// token. Pass an empty token if you are going to use Login or
+// SetTokenStore instead.
 func NewClient(accessToken string) Client {
-	return Client{
-		BaseURL:     "https://reflector.makerbot.com",
-		accessToken: accessToken,
-		http:        &http.Client{},
-	}
+	return NewClientWithBaseURL(accessToken, "https://reflector.makerbot.com")
 }
 
 // NewClientWithBaseURL returns a Client with the specified access
 // token and base URL
 func NewClientWithBaseURL(accessToken, baseURL string) Client {
 	return Client{
-		BaseURL:     baseURL,
-		accessToken: accessToken,
-		http:        &http.Client{},
+		BaseURL:      baseURL,
+		MaxRetries:   3,
+		RetryBackoff: 500 * time.Millisecond,
+		tokens:       &tokenSource{token: staticToken(accessToken)},
+		http:         &http.Client{Timeout: 30 * time.Second},
 	}
 }
@@ -0,0 +1,153 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+)
+
+// Agent connects a printer to a relay. It runs somewhere that can reach
+// the printer's JSON-RPC port, usually on the printer's LAN.
+type Agent struct {
+	Relay     string // Address (host:port) of the Server's relay
+	PrinterID string // ID the printer was added to the Server with
+	Secret    string // Secret the printer was added to the Server with
+	Printer   string // Address (host:port) of the printer's JSON-RPC port, usually port 9999
+
+	// AccessToken, if set, is used to authenticate every connection to
+	// the printer before it is handed to the client, which is what gives
+	// remote clients full access. Get one with
+	// makerbot.Client.AuthenticateWithThingiverse or by pushing the knob.
+	AccessToken string
+}
+
+// Run registers with the relay and answers calls until `ctx` is done or
+// the connection to the relay is lost. Calls that are in progress keep
+// going after it returns. Run it in a loop to reconnect.
+func (a *Agent) Run(ctx context.Context) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", a.Relay)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	stop := make(chan struct{})
+	defer close(stop)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-stop:
+		}
+	}()
+
+	params, _ := json.Marshal(registerParams{a.PrinterID, a.Secret})
+	err = writePacket(conn, rpcPacket{ID: json.RawMessage(`"register"`), Method: "register", Params: params})
+	if err != nil {
+		return err
+	}
+
+	dec := json.NewDecoder(conn)
+
+	var p rpcPacket
+	err = dec.Decode(&p)
+	if err != nil {
+		return err
+	}
+
+	if string(p.Result) != "true" {
+		return errors.New("relay refused the printer ID or secret")
+	}
+
+	for {
+		err = dec.Decode(&p)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			return err
+		}
+
+		if p.Method != "call" {
+			continue
+		}
+
+		var params callParams
+		json.Unmarshal(p.Params, &params)
+
+		go a.answer(ctx, params)
+	}
+}
+
+func (a *Agent) answer(ctx context.Context, params callParams) error {
+	var d net.Dialer
+
+	printer, err := d.DialContext(ctx, "tcp", a.Printer)
+	if err != nil {
+		return err
+	}
+
+	conn := &relayConn{printer, printer}
+
+	if a.AccessToken != "" {
+		conn, err = a.authenticate(printer)
+		if err != nil {
+			printer.Close()
+			return err
+		}
+	}
+
+	relay, err := d.DialContext(ctx, "tcp", a.Relay)
+	if err != nil {
+		printer.Close()
+		return err
+	}
+
+	b, _ := json.Marshal(params)
+	err = writePacket(relay, rpcPacket{Method: "answer", Params: b})
+	if err != nil {
+		printer.Close()
+		relay.Close()
+		return err
+	}
+
+	pipe(relay, conn)
+	return nil
+}
+
+// authenticate authenticates `printer` with the AccessToken. Anything
+// else the printer sends in the meantime (e.g. state notifications) is
+// dropped.
+func (a *Agent) authenticate(printer net.Conn) (*relayConn, error) {
+	params, _ := json.Marshal(map[string]string{"access_token": a.AccessToken})
+	id := json.RawMessage(`"agent-authenticate"`)
+
+	err := writePacket(printer, rpcPacket{ID: id, Method: "authenticate", Params: params})
+	if err != nil {
+		return nil, err
+	}
+
+	dec := json.NewDecoder(printer)
+	for {
+		var p rpcPacket
+		err = dec.Decode(&p)
+		if err != nil {
+			return nil, err
+		}
+
+		if string(p.ID) != string(id) {
+			continue
+		}
+
+		if p.Error != nil {
+			return nil, fmt.Errorf("printer refused the access token: %s", p.Error.Message)
+		}
+
+		return newRelayConn(printer, dec), nil
+	}
+}
@@ -0,0 +1,276 @@
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"time"
+)
+
+// The relay speaks JSON-RPC, like printers do. The first packet on a
+// connection says who is connecting:
+//
+//   - "auth_packet" is sent by clients (see makerbot.Client.ConnectRemote)
+//     to join a call. The relay answers `true` once the printer's side of
+//     the call is connected, or `false` if the call is invalid.
+//   - "register" is sent by agents to open their control connection. The
+//     relay answers `true`, then sends a "call" notification on it every
+//     time a client calls the printer.
+//   - "answer" is sent by agents on a new connection to join a call. It
+//     gets no answer; everything after it is the printer's side of the call.
+//
+// Once both sides of a call are connected, the relay copies bytes between
+// them until one of them disconnects.
+
+type rpcPacket struct {
+	Version string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type authPacketParams struct {
+	CallID     string `json:"call_id"`
+	ClientCode string `json:"client_code"`
+	PrinterID  string `json:"printer_id"`
+}
+
+type registerParams struct {
+	PrinterID string `json:"printer_id"`
+	Secret    string `json:"secret"`
+}
+
+type callParams struct {
+	CallID      string `json:"call_id"`
+	PrinterCode string `json:"printer_code"`
+}
+
+// relayConn is a connection along with the bytes that were read from it
+// while decoding its first packets, but not used
+type relayConn struct {
+	net.Conn
+	r io.Reader
+}
+
+func newRelayConn(conn net.Conn, dec *json.Decoder) *relayConn {
+	return &relayConn{conn, io.MultiReader(dec.Buffered(), conn)}
+}
+
+func (c *relayConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
+
+func writePacket(w io.Writer, p rpcPacket) error {
+	p.Version = "2.0"
+
+	b, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(b)
+	return err
+}
+
+func reply(w io.Writer, id json.RawMessage, result bool) error {
+	res := json.RawMessage("false")
+	if result {
+		res = json.RawMessage("true")
+	}
+
+	return writePacket(w, rpcPacket{ID: id, Result: res})
+}
+
+// notify sends a notification to the printer's agent over `control`
+func (p *printer) notify(control net.Conn, method string, params interface{}) error {
+	b, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+
+	p.wMux.Lock()
+	defer p.wMux.Unlock()
+
+	return writePacket(control, rpcPacket{Method: method, Params: b})
+}
+
+// pipe copies bytes between `a` and `b` until either of them is closed
+func pipe(a, b net.Conn) {
+	done := make(chan struct{}, 2)
+
+	go func() {
+		io.Copy(a, b)
+		done <- struct{}{}
+	}()
+
+	go func() {
+		io.Copy(b, a)
+		done <- struct{}{}
+	}()
+
+	<-done
+	a.Close()
+	b.Close()
+	<-done
+}
+
+// ServeRelay accepts relay connections from clients and agents on `l`
+// until it is closed
+func (s *Server) ServeRelay(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+
+		go s.handleConn(conn)
+	}
+}
+
+func (s *Server) handleConn(conn net.Conn) {
+	// Don't let connections that never say anything pile up
+	conn.SetReadDeadline(time.Now().Add(s.opts.CallTimeout))
+
+	dec := json.NewDecoder(conn)
+
+	var p rpcPacket
+	err := dec.Decode(&p)
+	if err != nil {
+		conn.Close()
+		return
+	}
+
+	conn.SetReadDeadline(time.Time{})
+
+	switch p.Method {
+	case "auth_packet":
+		err = s.handleClient(newRelayConn(conn, dec), p)
+	case "register":
+		err = s.handleAgent(conn, dec, p)
+	case "answer":
+		err = s.handleAnswer(newRelayConn(conn, dec), p)
+	default:
+		err = errors.New("unknown method")
+	}
+
+	if err != nil {
+		conn.Close()
+	}
+}
+
+func (s *Server) handleClient(conn *relayConn, p rpcPacket) error {
+	var params authPacketParams
+	json.Unmarshal(p.Params, &params)
+
+	s.mux.Lock()
+	c, ok := s.calls[params.CallID]
+	valid := ok && !c.claimed && c.clientCode == params.ClientCode && c.printerID == params.PrinterID
+	if valid {
+		c.claimed = true
+	}
+	s.mux.Unlock()
+
+	if !valid {
+		reply(conn, p.ID, false)
+		return errors.New("invalid call")
+	}
+
+	var printer *relayConn
+	select {
+	case printer = <-c.printer:
+	case <-time.After(s.opts.CallTimeout):
+	}
+
+	s.mux.Lock()
+	if s.calls[c.id] == c {
+		delete(s.calls, c.id)
+	}
+	s.mux.Unlock()
+
+	if printer == nil {
+		reply(conn, p.ID, false)
+		return errors.New("printer did not answer the call")
+	}
+
+	err := reply(conn, p.ID, true)
+	if err != nil {
+		printer.Close()
+		return err
+	}
+
+	pipe(conn, printer)
+	return nil
+}
+
+func (s *Server) handleAnswer(conn *relayConn, p rpcPacket) error {
+	var params callParams
+	json.Unmarshal(p.Params, &params)
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	c, ok := s.calls[params.CallID]
+	if !ok || c.printerCode != params.PrinterCode {
+		return errors.New("invalid call")
+	}
+
+	select {
+	case c.printer <- conn:
+		return nil
+	default:
+		return errors.New("call was already answered")
+	}
+}
+
+func (s *Server) handleAgent(conn net.Conn, dec *json.Decoder, p rpcPacket) error {
+	var params registerParams
+	json.Unmarshal(p.Params, &params)
+
+	s.mux.Lock()
+	printer, ok := s.printers[params.PrinterID]
+	valid := ok && subtle.ConstantTimeCompare([]byte(printer.secret), []byte(params.Secret)) == 1
+	var old net.Conn
+	if valid {
+		old = printer.control
+		printer.control = conn
+	}
+	s.mux.Unlock()
+
+	if !valid {
+		reply(conn, p.ID, false)
+		return errors.New("invalid printer or secret")
+	}
+
+	// Only one agent per printer; the newest one wins
+	if old != nil {
+		old.Close()
+	}
+
+	printer.wMux.Lock()
+	err := reply(conn, p.ID, true)
+	printer.wMux.Unlock()
+
+	if err == nil {
+		// Agents don't send anything else; this returns once they disconnect
+		for err == nil {
+			err = dec.Decode(&p)
+		}
+	}
+
+	s.mux.Lock()
+	if printer.control == conn {
+		printer.control = nil
+	}
+	s.mux.Unlock()
+
+	return err
+}
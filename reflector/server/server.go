@@ -0,0 +1,277 @@
+// Package server is a self-hostable, Reflector-compatible remote access
+// server for MakerBot printers.
+//
+// It has two parts: an HTTP API with the `/printers` and `/call`
+// endpoints that reflector.Client uses, and a TCP relay that pairs a
+// client's connection with a printer's connection. Printers are reached
+// through an Agent, which runs on the printer's LAN and connects to the
+// relay on its behalf. makerbot.Client.ConnectRemote works against it
+// unchanged:
+//
+//	srv := server.New(server.Options{
+//		RelayAddr: "relay.example.com:9998",
+//		Authorize: func(token string) (string, bool) { return "me", token == "token" },
+//	})
+//	srv.AddPrinter("me", reflector.Printer{ID: "my-printer"}, "agent secret")
+//
+//	l, _ := net.Listen("tcp", ":9998")
+//	go srv.ServeRelay(l)
+//	http.ListenAndServe(":8080", srv)
+//
+//	// On the printer's LAN:
+//	agent := server.Agent{Relay: "relay.example.com:9998", PrinterID: "my-printer", Secret: "agent secret", Printer: "192.168.1.10:9999"}
+//	agent.Run(context.Background())
+//
+//	// Anywhere:
+//	refl := reflector.NewClientWithBaseURL("token", "http://relay.example.com:8080")
+//	client.ConnectRemote("my-printer", "token", &refl)
+package server
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tjhorner/makerbot-rpc/reflector"
+)
+
+// Options configures a Server
+type Options struct {
+	// RelayAddr is the address (host:port) clients and agents are told
+	// to connect to for the relay. The host has to be an IPv4 address or
+	// a host name, since that is all ConnectRemote understands.
+	RelayAddr string
+
+	// Authorize maps an access token to the account it belongs to. Only
+	// the printers added to that account are visible to the token. If it
+	// is nil, every token is refused.
+	Authorize func(accessToken string) (account string, ok bool)
+
+	// CallTimeout is how long a call waits for both the client and the
+	// printer to connect to the relay (default 30 seconds)
+	CallTimeout time.Duration
+}
+
+type printer struct {
+	account string
+	info    reflector.Printer
+	secret  string
+	control net.Conn // nil if the printer's agent isn't connected
+	wMux    sync.Mutex
+}
+
+type call struct {
+	id          string
+	printerID   string
+	clientCode  string
+	printerCode string
+	printer     chan *relayConn // buffered; receives the printer's side of the call
+	claimed     bool            // whether a client connected with this call
+}
+
+// Server is a Reflector-compatible HTTP API and relay. Its zero value is
+// not usable; create one with New.
+type Server struct {
+	opts     Options
+	printers map[string]*printer
+	calls    map[string]*call
+	mux      sync.Mutex
+}
+
+// New creates a Server with no printers
+func New(opts Options) *Server {
+	if opts.CallTimeout <= 0 {
+		opts.CallTimeout = 30 * time.Second
+	}
+
+	return &Server{
+		opts:     opts,
+		printers: make(map[string]*printer),
+		calls:    make(map[string]*call),
+	}
+}
+
+// AddPrinter adds a printer to `account`, or updates it if it was
+// already added. Its agent has to authenticate with `secret`.
+func (s *Server) AddPrinter(account string, info reflector.Printer, secret string) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if p, ok := s.printers[info.ID]; ok {
+		p.account = account
+		p.info = info
+		p.secret = secret
+		return
+	}
+
+	s.printers[info.ID] = &printer{account: account, info: info, secret: secret}
+}
+
+// RemovePrinter removes the printer with `id` and disconnects its agent
+func (s *Server) RemovePrinter(id string) {
+	s.mux.Lock()
+	var control net.Conn
+	if p, ok := s.printers[id]; ok {
+		control = p.control
+	}
+	delete(s.printers, id)
+	s.mux.Unlock()
+
+	if control != nil {
+		control.Close()
+	}
+}
+
+// Printers returns the printers of `account`, with Online set if their
+// agent is connected
+func (s *Server) Printers(account string) []reflector.Printer {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	printers := []reflector.Printer{}
+	for _, p := range s.printers {
+		if p.account == account {
+			printers = append(printers, p.snapshot())
+		}
+	}
+
+	return printers
+}
+
+// snapshot must be called with s.mux held
+func (p *printer) snapshot() reflector.Printer {
+	info := p.info
+	info.Online = p.control != nil
+	return info
+}
+
+func (s *Server) authorize(r *http.Request) (string, bool) {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return "", false
+	}
+
+	token := strings.TrimPrefix(auth, "Bearer ")
+	if s.opts.Authorize == nil {
+		return "", false
+	}
+
+	return s.opts.Authorize(token)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	writeJSON(w, status, map[string]string{"error": code, "message": message})
+}
+
+// ServeHTTP serves the Reflector API
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	account, ok := s.authorize(r)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "unauthorized", "missing or invalid access token")
+		return
+	}
+
+	switch {
+	case r.URL.Path == "/printers" && r.Method == "GET":
+		writeJSON(w, http.StatusOK, map[string]interface{}{"printers": s.Printers(account)})
+	case strings.HasPrefix(r.URL.Path, "/printers/") && r.Method == "GET":
+		s.servePrinter(w, account, strings.TrimPrefix(r.URL.Path, "/printers/"))
+	case r.URL.Path == "/call" && r.Method == "POST":
+		s.serveCall(w, account, r.FormValue("printer_id"))
+	default:
+		writeError(w, http.StatusNotFound, "not_found", "no such endpoint")
+	}
+}
+
+func (s *Server) servePrinter(w http.ResponseWriter, account, id string) {
+	s.mux.Lock()
+	p, ok := s.printers[id]
+	var info reflector.Printer
+	if ok {
+		info = p.snapshot()
+	}
+	s.mux.Unlock()
+
+	if !ok || p.account != account {
+		writeError(w, http.StatusNotFound, "not_found", "no such printer")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"printer": info})
+}
+
+func (s *Server) serveCall(w http.ResponseWriter, account, id string) {
+	s.mux.Lock()
+
+	p, ok := s.printers[id]
+	if !ok || p.account != account {
+		s.mux.Unlock()
+		writeError(w, http.StatusNotFound, "not_found", "no such printer")
+		return
+	}
+
+	control := p.control
+	if control == nil {
+		s.mux.Unlock()
+		writeError(w, http.StatusConflict, "printer_offline", "the printer is not connected")
+		return
+	}
+
+	c := &call{
+		id:          uuid.New().String(),
+		printerID:   id,
+		clientCode:  uuid.New().String(),
+		printerCode: uuid.New().String(),
+		printer:     make(chan *relayConn, 1),
+	}
+	s.calls[c.id] = c
+
+	s.mux.Unlock()
+
+	time.AfterFunc(s.opts.CallTimeout, func() { s.expireCall(c) })
+
+	err := p.notify(control, "call", callParams{CallID: c.id, PrinterCode: c.printerCode})
+	if err != nil {
+		s.expireCall(c)
+		writeError(w, http.StatusBadGateway, "printer_unreachable", "could not reach the printer's agent")
+		return
+	}
+
+	var res reflector.CallPrinterResponse
+	res.Call.ID = c.id
+	res.Call.Relay = s.opts.RelayAddr
+	res.Call.ClientCode = c.clientCode
+
+	writeJSON(w, http.StatusOK, res)
+}
+
+// expireCall forgets `c` and closes the printer's side of it, unless a
+// client is already using it
+func (s *Server) expireCall(c *call) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if s.calls[c.id] != c {
+		return
+	}
+
+	delete(s.calls, c.id)
+
+	if !c.claimed {
+		select {
+		case rc := <-c.printer:
+			rc.Close()
+		default:
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	makerbot "github.com/tjhorner/makerbot-rpc"
+	"github.com/tjhorner/makerbot-rpc/reflector"
+)
+
+// fakePrinter answers the JSON-RPC methods a Client needs to connect
+func fakePrinter(t *testing.T, authenticated chan<- string) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				defer conn.Close()
+
+				dec := json.NewDecoder(conn)
+				for {
+					var p rpcPacket
+					if dec.Decode(&p) != nil {
+						return
+					}
+
+					var result string
+					switch p.Method {
+					case "handshake":
+						result = `{"machine_name":"Remote Bot","iserial":"23C1"}`
+					case "authenticate":
+						var params map[string]string
+						json.Unmarshal(p.Params, &params)
+						authenticated <- params["access_token"]
+						result = `{}`
+					default:
+						result = `true`
+					}
+
+					writePacket(conn, rpcPacket{ID: p.ID, Result: json.RawMessage(result)})
+				}
+			}()
+		}
+	}()
+
+	return l
+}
+
+func TestConnectRemote(t *testing.T) {
+	authenticated := make(chan string, 1)
+	printer := fakePrinter(t, authenticated)
+	defer printer.Close()
+
+	relay, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer relay.Close()
+
+	srv := New(Options{
+		RelayAddr: relay.Addr().String(),
+		Authorize: func(token string) (string, bool) { return "account", token == "token" },
+	})
+	srv.AddPrinter("account", reflector.Printer{ID: "printer", MachineName: "Remote Bot"}, "secret")
+	srv.AddPrinter("someone else", reflector.Printer{ID: "other"}, "secret")
+
+	go srv.ServeRelay(relay)
+
+	api := httptest.NewServer(srv)
+	defer api.Close()
+
+	refl := reflector.NewClientWithBaseURL("token", api.URL)
+
+	// Offline until the agent connects
+	if _, err := refl.CallPrinter("printer"); err == nil {
+		t.Fatal("expected an error calling an offline printer")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	agent := Agent{
+		Relay:       relay.Addr().String(),
+		PrinterID:   "printer",
+		Secret:      "secret",
+		Printer:     printer.Addr().String(),
+		AccessToken: "local token",
+	}
+	go agent.Run(ctx)
+
+	var printers []reflector.Printer
+	for i := 0; i < 100; i++ {
+		printers, err = refl.GetPrinters()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(printers) == 1 && printers[0].Online {
+			break
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if len(printers) != 1 || printers[0].ID != "printer" || !printers[0].Online {
+		t.Fatalf("got printers %+v, want only the online printer", printers)
+	}
+
+	c := makerbot.NewClient()
+	err = c.ConnectRemote("printer", "token", &refl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if c.Printer.MachineName != "Remote Bot" {
+		t.Errorf("got machine name %q from the handshake", c.Printer.MachineName)
+	}
+
+	select {
+	case token := <-authenticated:
+		if token != "local token" {
+			t.Errorf("agent authenticated with %q", token)
+		}
+	default:
+		t.Error("agent did not authenticate with the printer")
+	}
+}
+
+func TestInvalidCall(t *testing.T) {
+	srv := New(Options{CallTimeout: time.Second})
+
+	relay, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer relay.Close()
+
+	go srv.ServeRelay(relay)
+
+	conn, err := net.Dial("tcp", relay.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	params, _ := json.Marshal(authPacketParams{"nope", "nope", "nope"})
+	writePacket(conn, rpcPacket{ID: json.RawMessage(`"1"`), Method: "auth_packet", Params: params})
+
+	var p rpcPacket
+	if err := json.NewDecoder(conn).Decode(&p); err != nil {
+		t.Fatal(err)
+	}
+
+	if string(p.Result) != "false" {
+		t.Errorf("got result %s for an invalid call, want false", p.Result)
+	}
+}
+
+func TestNoAuthorizeRefusesTokens(t *testing.T) {
+	srv := New(Options{})
+	srv.AddPrinter("", reflector.Printer{ID: "printer"}, "secret")
+
+	api := httptest.NewServer(srv)
+	defer api.Close()
+
+	refl := reflector.NewClientWithBaseURL("token", api.URL)
+	_, err := refl.GetPrinters()
+	if e, ok := err.(*reflector.Error); !ok || e.StatusCode != http.StatusUnauthorized {
+		t.Errorf("got error %v without Options.Authorize, want a 401", err)
+	}
+}
+
+func TestAgentWrongSecret(t *testing.T) {
+	srv := New(Options{})
+	srv.AddPrinter("", reflector.Printer{ID: "printer"}, "secret")
+
+	relay, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer relay.Close()
+
+	go srv.ServeRelay(relay)
+
+	agent := Agent{Relay: relay.Addr().String(), PrinterID: "printer", Secret: "wrong"}
+	if err := agent.Run(context.Background()); err == nil {
+		t.Error("expected an error registering with the wrong secret")
+	}
+}
+
+func TestRemovePrinter(t *testing.T) {
+	srv := New(Options{})
+	srv.AddPrinter("account", reflector.Printer{ID: "printer"}, "secret")
+
+	relay, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer relay.Close()
+
+	go srv.ServeRelay(relay)
+
+	done := make(chan error, 1)
+	agent := Agent{Relay: relay.Addr().String(), PrinterID: "printer", Secret: "secret"}
+	go func() { done <- agent.Run(context.Background()) }()
+
+	for i := 0; i < 100; i++ {
+		if printers := srv.Printers("account"); len(printers) == 1 && printers[0].Online {
+			break
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	srv.RemovePrinter("printer")
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("agent is still connected after its printer was removed")
+	}
+
+	if printers := srv.Printers("account"); len(printers) != 0 {
+		t.Errorf("got printers %+v after removing the only one", printers)
+	}
+}
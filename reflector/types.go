@@ -1,6 +1,14 @@
 package reflector
 
-import "net"
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
 
 // CallPrinterResponse represents a response from the
 // Client.CallPrinter method
@@ -16,3 +24,100 @@ type CallPrinterResponse struct {
 func (r *CallPrinterResponse) RelayAddr() (*net.TCPAddr, error) {
 	return net.ResolveTCPAddr("tcp", r.Call.Relay)
 }
+
+// Printer is a printer registered to a MakerBot account, as
+// listed by Reflector
+type Printer struct {
+	ID          string         `json:"id"`           // Reflector's ID for the printer, used with CallPrinter
+	Serial      string         `json:"iserial"`      // Serial number of the printer
+	MachineName string         `json:"machine_name"` // User-defined printer name
+	MachineType string         `json:"machine_type"` // The codename for this machine type
+	BotType     string         `json:"bot_type"`     // Codename for the bot type
+	Online      bool           `json:"online"`       // Whether the printer is currently connected to Reflector
+	Status      *PrinterStatus `json:"status"`       // What the printer was last doing, if it is online
+}
+
+// PrinterStatus is what a printer was last doing, as reported
+// to Reflector
+type PrinterStatus struct {
+	State    string `json:"state"`    // e.g. "idle" or "printing"
+	Step     string `json:"step"`     // Step of the current process, if any (see makerbot.PrintProcessStep)
+	Progress *int   `json:"progress"` // Progress of the current process, if any
+	Filename string `json:"filename"` // File being printed, if any
+}
+
+// printersResponse is the response from GET /printers, which is either
+// a bare array or an object with a `printers` array
+type printersResponse struct {
+	Printers []Printer
+}
+
+func (r *printersResponse) UnmarshalJSON(b []byte) error {
+	if strings.HasPrefix(strings.TrimSpace(string(b)), "[") {
+		return json.Unmarshal(b, &r.Printers)
+	}
+
+	var wrapped struct {
+		Printers []Printer `json:"printers"`
+	}
+
+	err := json.Unmarshal(b, &wrapped)
+	r.Printers = wrapped.Printers
+	return err
+}
+
+// printerResponse is the response from GET /printers/:id, which is
+// either a bare object or an object with a `printer` object
+type printerResponse struct {
+	Printer Printer
+}
+
+func (r *printerResponse) UnmarshalJSON(b []byte) error {
+	var wrapped struct {
+		Printer *Printer `json:"printer"`
+	}
+
+	err := json.Unmarshal(b, &wrapped)
+	if err == nil && wrapped.Printer != nil {
+		r.Printer = *wrapped.Printer
+		return nil
+	}
+
+	return json.Unmarshal(b, &r.Printer)
+}
+
+// Error is returned when Reflector responds with a non-2xx status
+type Error struct {
+	StatusCode int           // HTTP status code of the response
+	Message    string        // Error message from Reflector, if it sent one
+	Body       []byte        // Raw body of the response
+	RetryAfter time.Duration // How long Reflector asked us to wait before trying again, if it did (e.g. when rate limiting)
+}
+
+func (e *Error) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("reflector error (HTTP %d): %s", e.StatusCode, e.Message)
+	}
+
+	return fmt.Sprintf("reflector error (HTTP %d)", e.StatusCode)
+}
+
+func newError(status int, header http.Header, body []byte) *Error {
+	var res struct {
+		Error   interface{} `json:"error"`
+		Message string      `json:"message"`
+	}
+	json.Unmarshal(body, &res)
+
+	e := &Error{StatusCode: status, Message: res.Message, Body: body}
+
+	if secs, err := strconv.Atoi(header.Get("Retry-After")); err == nil && secs > 0 {
+		e.RetryAfter = time.Duration(secs) * time.Second
+	}
+
+	if msg, ok := res.Error.(string); ok && e.Message == "" {
+		e.Message = msg
+	}
+
+	return e
+}
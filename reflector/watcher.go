@@ -0,0 +1,259 @@
+package reflector
+
+import (
+	"math/rand"
+	"net/http"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// WatchEventType is the kind of change a WatchEvent reports
+type WatchEventType int
+
+const (
+	// PrinterOnline means a printer connected to Reflector, or was
+	// online when the Watcher first saw it
+	PrinterOnline WatchEventType = iota
+	// PrinterOffline means a printer disconnected from Reflector or was
+	// removed from the account
+	PrinterOffline
+	// PrinterStateChanged means an online printer's Status changed
+	PrinterStateChanged
+)
+
+func (t WatchEventType) String() string {
+	switch t {
+	case PrinterOnline:
+		return "PrinterOnline"
+	case PrinterOffline:
+		return "PrinterOffline"
+	case PrinterStateChanged:
+		return "PrinterStateChanged"
+	}
+
+	return "Unknown"
+}
+
+// WatchEvent is emitted by a Watcher when a printer's status changes
+type WatchEvent struct {
+	Type     WatchEventType
+	Printer  Printer  // The printer as it is now
+	Previous *Printer // The printer as it was in the previous poll, if it was in it
+}
+
+// Watcher polls Reflector for the printers of an account and reports
+// when they come online, go offline or change state, without connecting
+// to any of them.
+type Watcher struct {
+	Interval   time.Duration // Time between polls (default 30 seconds)
+	MaxBackoff time.Duration // Upper bound on the time between polls after errors (default 10 minutes)
+
+	client   *Client
+	printers map[string]Printer
+	failures int
+	eventCbs []func(WatchEvent)
+	errCb    *func(error)
+	stop     chan struct{}
+	mux      sync.Mutex
+}
+
+// NewWatcher creates a Watcher that polls with `c`. Call Start to
+// begin polling.
+func NewWatcher(c *Client) *Watcher {
+	return &Watcher{
+		Interval:   30 * time.Second,
+		MaxBackoff: 10 * time.Minute,
+		client:     c,
+	}
+}
+
+// HandleEvent calls `cb` every time a printer comes online, goes offline
+// or changes state
+func (w *Watcher) HandleEvent(cb func(WatchEvent)) {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	w.eventCbs = append(w.eventCbs, cb)
+}
+
+// HandleError calls `cb` when a poll fails. The Watcher keeps polling,
+// backing off until polls succeed again.
+func (w *Watcher) HandleError(cb func(error)) {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	w.errCb = &cb
+}
+
+// Printers returns the printers as of the last successful poll, or nil
+// if there wasn't one yet
+func (w *Watcher) Printers() []Printer {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	if w.printers == nil {
+		return nil
+	}
+
+	printers := make([]Printer, 0, len(w.printers))
+	for _, p := range w.printers {
+		printers = append(printers, p)
+	}
+
+	return printers
+}
+
+// Printer returns the printer with `id` as of the last successful poll
+func (w *Watcher) Printer(id string) (Printer, bool) {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	p, ok := w.printers[id]
+	return p, ok
+}
+
+// Start begins polling in the background until Stop is called
+func (w *Watcher) Start() {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	if w.stop != nil {
+		return
+	}
+
+	if w.Interval <= 0 {
+		w.Interval = 30 * time.Second
+	}
+
+	if w.MaxBackoff < w.Interval {
+		w.MaxBackoff = 10 * time.Minute
+	}
+
+	stop := make(chan struct{})
+	w.stop = stop
+
+	go func() {
+		for {
+			delay := w.Interval
+			if err := w.Poll(); err != nil {
+				delay = w.backoff(err)
+			}
+
+			select {
+			case <-time.After(delay):
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops polling. The last snapshot is kept.
+func (w *Watcher) Stop() {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	if w.stop != nil {
+		close(w.stop)
+		w.stop = nil
+	}
+}
+
+// backoff returns how long to wait before polling again after `err`,
+// doubling the interval for every consecutive failure, up to MaxBackoff.
+// The delay is jittered so that many Watchers don't poll in lockstep.
+// If Reflector said when to try again, we don't try before that.
+func (w *Watcher) backoff(err error) time.Duration {
+	w.mux.Lock()
+	failures := w.failures
+	w.mux.Unlock()
+
+	delay := w.MaxBackoff
+	if failures < 32 && w.Interval<<uint(failures) < w.MaxBackoff {
+		delay = w.Interval << uint(failures)
+	}
+
+	// Anywhere from half of the delay to all of it
+	delay = delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+
+	if rerr, ok := err.(*Error); ok && rerr.StatusCode == http.StatusTooManyRequests && rerr.RetryAfter > delay {
+		delay = rerr.RetryAfter
+	}
+
+	return delay
+}
+
+// Poll gets the printers from Reflector once and emits events for what
+// changed since the previous poll. Start calls it on every Interval.
+func (w *Watcher) Poll() error {
+	printers, err := w.client.GetPrinters()
+
+	w.mux.Lock()
+
+	if err != nil {
+		w.failures++
+		errCb := w.errCb
+		w.mux.Unlock()
+
+		if errCb != nil {
+			(*errCb)(err)
+		}
+
+		return err
+	}
+
+	w.failures = 0
+
+	current := make(map[string]Printer, len(printers))
+	for _, p := range printers {
+		current[p.ID] = p
+	}
+
+	events := diffPrinters(w.printers, current)
+	w.printers = current
+	cbs := w.eventCbs
+
+	w.mux.Unlock()
+
+	for _, ev := range events {
+		for _, cb := range cbs {
+			cb(ev)
+		}
+	}
+
+	return nil
+}
+
+func diffPrinters(old, current map[string]Printer) []WatchEvent {
+	var events []WatchEvent
+
+	for id, p := range current {
+		prev, ok := old[id]
+
+		var previous *Printer
+		if ok {
+			previous = &prev
+		}
+
+		switch {
+		case p.Online && (!ok || !prev.Online):
+			events = append(events, WatchEvent{PrinterOnline, p, previous})
+		case !p.Online && ok && prev.Online:
+			events = append(events, WatchEvent{PrinterOffline, p, previous})
+		case p.Online && !reflect.DeepEqual(p.Status, prev.Status):
+			events = append(events, WatchEvent{PrinterStateChanged, p, previous})
+		}
+	}
+
+	for id, prev := range old {
+		if _, ok := current[id]; !ok && prev.Online {
+			prev := prev
+			gone := prev
+			gone.Online = false
+			events = append(events, WatchEvent{PrinterOffline, gone, &prev})
+		}
+	}
+
+	return events
+}
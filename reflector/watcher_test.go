@@ -0,0 +1,135 @@
+package reflector
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWatcherPoll(t *testing.T) {
+	var mux sync.Mutex
+	body := `[{"id":"a","online":true,"status":{"state":"idle"}},{"id":"b","online":false}]`
+
+	c, done := testClient(func(w http.ResponseWriter, r *http.Request) {
+		mux.Lock()
+		defer mux.Unlock()
+
+		w.Write([]byte(body))
+	})
+	defer done()
+
+	w := NewWatcher(c)
+
+	var events []WatchEvent
+	w.HandleEvent(func(ev WatchEvent) {
+		events = append(events, ev)
+	})
+
+	poll := func(next string) []WatchEvent {
+		mux.Lock()
+		body = next
+		mux.Unlock()
+
+		events = nil
+		if err := w.Poll(); err != nil {
+			t.Fatal(err)
+		}
+
+		return events
+	}
+
+	evs := poll(body)
+	if len(evs) != 1 || evs[0].Type != PrinterOnline || evs[0].Printer.ID != "a" || evs[0].Previous != nil {
+		t.Fatalf("first poll: got %+v, want a online", evs)
+	}
+
+	if len(w.Printers()) != 2 {
+		t.Errorf("got %d printers in the snapshot, want 2", len(w.Printers()))
+	}
+
+	evs = poll(`[{"id":"a","online":true,"status":{"state":"idle"}},{"id":"b","online":false}]`)
+	if len(evs) != 0 {
+		t.Fatalf("unchanged poll: got %+v", evs)
+	}
+
+	evs = poll(`[{"id":"a","online":true,"status":{"state":"printing"}},{"id":"b","online":true}]`)
+	if len(evs) != 2 {
+		t.Fatalf("got %+v, want a changed state and b online", evs)
+	}
+
+	for _, ev := range evs {
+		switch ev.Printer.ID {
+		case "a":
+			if ev.Type != PrinterStateChanged || ev.Previous.Status.State != "idle" || ev.Printer.Status.State != "printing" {
+				t.Errorf("got %s for a", ev.Type)
+			}
+		case "b":
+			if ev.Type != PrinterOnline {
+				t.Errorf("got %s for b, want PrinterOnline", ev.Type)
+			}
+		}
+	}
+
+	evs = poll(`[{"id":"b","online":false}]`)
+	if len(evs) != 2 || evs[0].Type != PrinterOffline || evs[1].Type != PrinterOffline {
+		t.Fatalf("got %+v, want a and b offline", evs)
+	}
+
+	if p, ok := w.Printer("a"); ok {
+		t.Errorf("a is still in the snapshot: %+v", p)
+	}
+}
+
+func TestWatcherBackoff(t *testing.T) {
+	calls := 0
+	c, done := testClient(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Retry-After", "120")
+		w.WriteHeader(http.StatusTooManyRequests)
+	})
+	defer done()
+
+	w := NewWatcher(c)
+	w.Interval = time.Second
+	w.MaxBackoff = time.Minute
+
+	var errs int
+	w.HandleError(func(error) { errs++ })
+
+	var delays []time.Duration
+	for i := 0; i < 8; i++ {
+		err := w.Poll()
+		if err == nil {
+			t.Fatal("expected an error")
+		}
+
+		delays = append(delays, w.backoff(err))
+	}
+
+	if calls != 8 || errs != 8 {
+		t.Errorf("rate limited requests were retried (%d calls, %d errors)", calls, errs)
+	}
+
+	for _, d := range delays {
+		if d != 2*time.Minute {
+			t.Errorf("got delay %s, want Retry-After of 2m", d)
+		}
+	}
+
+	// Without Retry-After, the delay grows to MaxBackoff and stays within it
+	err := &Error{StatusCode: http.StatusTooManyRequests}
+	for failures := 1; failures < 40; failures++ {
+		w.failures = failures
+
+		max := time.Second << uint(failures)
+		if failures >= 6 {
+			max = time.Minute
+		}
+
+		d := w.backoff(err)
+		if d < max/2 || d > max {
+			t.Errorf("after %d failures got delay %s, want between %s and %s", failures, d, max/2, max)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package makerbot
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+var errNoPrinterState = errors.New("printer has not sent its state yet")
+
+func (c *Client) metadata() (*PrinterMetadata, error) {
+	if c.Printer == nil || c.Printer.Metadata == nil {
+		return nil, errNoPrinterState
+	}
+
+	return c.Printer.Metadata, nil
+}
+
+// Sound returns whether the printer's sounds are enabled, according
+// to the latest state the printer sent.
+func (c *Client) Sound() (bool, error) {
+	m, err := c.metadata()
+	if err != nil {
+		return false, err
+	}
+
+	return m.Sound, nil
+}
+
+// AutoUnload returns the printer's auto-unload setting, according
+// to the latest state the printer sent.
+func (c *Client) AutoUnload() (string, error) {
+	m, err := c.metadata()
+	if err != nil {
+		return "", err
+	}
+
+	return m.AutoUnload, nil
+}
+
+// DisabledErrors returns the error codes the printer has been told
+// to ignore, according to the latest state the printer sent.
+func (c *Client) DisabledErrors() ([]int, error) {
+	m, err := c.metadata()
+	if err != nil {
+		return nil, err
+	}
+
+	return m.DisabledErrorCodes(), nil
+}
+
+// DisabledErrorCodes returns DisabledErrors as a sorted list of
+// error codes. Values that aren't numbers are skipped.
+func (m *PrinterMetadata) DisabledErrorCodes() []int {
+	codes := []int{}
+
+	for _, e := range m.DisabledErrors {
+		if f, ok := e.(float64); ok {
+			codes = append(codes, int(f))
+		}
+	}
+
+	sort.Ints(codes)
+	return codes
+}
+
+type rpcSetSoundParams struct {
+	State bool `json:"state"`
+}
+
+// SetSound enables or disables the printer's sounds.
+func (c *Client) SetSound(enabled bool) error {
+	return c.call("set_sound_state", rpcSetSoundParams{enabled}, nil)
+}
+
+type rpcSetAutoUnloadParams struct {
+	Unload string `json:"unload"`
+}
+
+// SetAutoUnload changes the printer's auto-unload setting.
+func (c *Client) SetAutoUnload(mode string) error {
+	return c.call("set_auto_unload", rpcSetAutoUnloadParams{mode}, nil)
+}
+
+type rpcSetDisabledErrorsParams struct {
+	Errors []int `json:"errors"`
+}
+
+// SetDisabledErrors replaces the list of error codes the printer
+// will ignore.
+func (c *Client) SetDisabledErrors(codes []int) error {
+	if codes == nil {
+		codes = []int{}
+	}
+
+	return c.call("set_disabled_errors", rpcSetDisabledErrorsParams{codes}, nil)
+}
+
+// PrinterProfile is a set of printer settings that can be compared
+// against a printer's state and applied to it with ApplyProfile.
+//
+// Nil fields are left untouched.
+type PrinterProfile struct {
+	Sound          *bool   `json:"sound,omitempty"`
+	AutoUnload     *string `json:"auto_unload,omitempty"`
+	DisabledErrors []int   `json:"disabled_errors,omitempty"`
+}
+
+// ProfileChange is a single setting that differs between a
+// PrinterProfile and a printer's state.
+type ProfileChange struct {
+	Setting string      `json:"setting"` // Name of the setting, e.g. "sound"
+	Old     interface{} `json:"old"`     // Value the printer currently has
+	New     interface{} `json:"new"`     // Value the profile wants
+}
+
+func (c ProfileChange) String() string {
+	return fmt.Sprintf("%s: %v -> %v", c.Setting, c.Old, c.New)
+}
+
+// ProfileFromMetadata builds a PrinterProfile with every setting
+// from `m` filled in.
+func ProfileFromMetadata(m *PrinterMetadata) PrinterProfile {
+	sound := m.Sound
+	autoUnload := m.AutoUnload
+
+	return PrinterProfile{
+		Sound:          &sound,
+		AutoUnload:     &autoUnload,
+		DisabledErrors: m.DisabledErrorCodes(),
+	}
+}
+
+// Diff returns the settings that would change if the profile were
+// applied to a printer with state `m`.
+func (p PrinterProfile) Diff(m *PrinterMetadata) []ProfileChange {
+	var changes []ProfileChange
+
+	if p.Sound != nil && *p.Sound != m.Sound {
+		changes = append(changes, ProfileChange{"sound", m.Sound, *p.Sound})
+	}
+
+	if p.AutoUnload != nil && *p.AutoUnload != m.AutoUnload {
+		changes = append(changes, ProfileChange{"auto_unload", m.AutoUnload, *p.AutoUnload})
+	}
+
+	if p.DisabledErrors != nil {
+		want := append([]int{}, p.DisabledErrors...)
+		sort.Ints(want)
+
+		have := m.DisabledErrorCodes()
+		if !reflect.DeepEqual(want, have) {
+			changes = append(changes, ProfileChange{"disabled_errors", have, want})
+		}
+	}
+
+	return changes
+}
+
+// ApplyProfile changes every setting of the printer that differs from
+// `p` and returns what was changed. If an error occurs partway, the
+// changes applied so far are returned along with it.
+func (c *Client) ApplyProfile(p PrinterProfile) ([]ProfileChange, error) {
+	m, err := c.metadata()
+	if err != nil {
+		return nil, err
+	}
+
+	var applied []ProfileChange
+
+	for _, change := range p.Diff(m) {
+		switch change.Setting {
+		case "sound":
+			err = c.SetSound(change.New.(bool))
+		case "auto_unload":
+			err = c.SetAutoUnload(change.New.(string))
+		case "disabled_errors":
+			err = c.SetDisabledErrors(change.New.([]int))
+		}
+
+		if err != nil {
+			return applied, err
+		}
+
+		applied = append(applied, change)
+	}
+
+	return applied, nil
+}
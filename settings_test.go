@@ -0,0 +1,43 @@
+package makerbot
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPrinterProfileDiff(t *testing.T) {
+	yes, no := true, false
+	on, off := "on", "off"
+
+	m := &PrinterMetadata{
+		Sound:          true,
+		AutoUnload:     "off",
+		DisabledErrors: []interface{}{float64(1045), float64(81)},
+	}
+
+	tests := []struct {
+		name    string
+		profile PrinterProfile
+		want    []ProfileChange
+	}{
+		{"empty profile", PrinterProfile{}, nil},
+		{"same settings", ProfileFromMetadata(m), nil},
+		{"same settings, other order", PrinterProfile{Sound: &yes, AutoUnload: &off, DisabledErrors: []int{1045, 81}}, nil},
+		{"sound", PrinterProfile{Sound: &no}, []ProfileChange{{"sound", true, false}}},
+		{"auto unload", PrinterProfile{AutoUnload: &on}, []ProfileChange{{"auto_unload", "off", "on"}}},
+		{"disabled errors", PrinterProfile{DisabledErrors: []int{81}}, []ProfileChange{{"disabled_errors", []int{81, 1045}, []int{81}}}},
+		{"no disabled errors", PrinterProfile{DisabledErrors: []int{}}, []ProfileChange{{"disabled_errors", []int{81, 1045}, []int{}}}},
+		{"everything", PrinterProfile{Sound: &no, AutoUnload: &on, DisabledErrors: []int{7}}, []ProfileChange{
+			{"sound", true, false},
+			{"auto_unload", "off", "on"},
+			{"disabled_errors", []int{81, 1045}, []int{7}},
+		}},
+	}
+
+	for _, test := range tests {
+		got := test.profile.Diff(m)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %v, wanted %v", test.name, got, test.want)
+		}
+	}
+}
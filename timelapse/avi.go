@@ -0,0 +1,21 @@
+package timelapse
+
+import (
+	"io"
+
+	"github.com/tjhorner/makerbot-rpc/camera"
+)
+
+// WriteAVI assembles the JPEG files at `frames` into a Motion JPEG
+// AVI video played back at `fps` frames per second, and writes it to `w`.
+// It is the same as camera.WriteAVIFiles.
+//
+// All frames are expected to have the same dimensions as the first one.
+func WriteAVI(w io.Writer, frames []string, fps int) error {
+	return camera.WriteAVIFiles(w, frames, fps)
+}
+
+// WriteAVIFile is like WriteAVI but creates the file at `path`
+func WriteAVIFile(path string, frames []string, fps int) error {
+	return camera.CreateAVI(path, frames, fps)
+}
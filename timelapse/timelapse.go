@@ -0,0 +1,271 @@
+// Package timelapse records a timelapse of every print a MakerBot
+// printer runs, using its camera.
+package timelapse
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	makerbot "github.com/tjhorner/makerbot-rpc"
+)
+
+// Source is something that can take camera snapshots, usually
+// a *makerbot.Client.
+type Source interface {
+	GetCameraFrame() (*makerbot.CameraFrame, error)
+}
+
+// Trigger decides when a frame is captured
+type Trigger int
+
+const (
+	// TriggerInterval captures a frame every Options.Interval
+	TriggerInterval Trigger = iota
+	// TriggerProgress captures a frame every Options.ProgressStep percent of progress
+	TriggerProgress
+	// TriggerEstimatedLayer approximates a frame per layer. The printer
+	// only reports its progress as a whole percentage, so the current layer
+	// is estimated from it and Options.Layers rather than read from the
+	// toolpath. That means at most one frame per percent: prints with more
+	// than 100 layers get fewer frames than they have layers, and the frames
+	// are not taken exactly at layer changes.
+	TriggerEstimatedLayer
+)
+
+// Options configures a Recorder
+type Options struct {
+	Dir          string        // Directory in which a directory is created for every job
+	Trigger      Trigger       // When to capture frames
+	Interval     time.Duration // Time between frames for TriggerInterval (default 10 seconds)
+	ProgressStep int           // Progress between frames for TriggerProgress (default 1%)
+	Layers       int           // Total number of layers for TriggerEstimatedLayer; see printfile.Metadata.NumZLayers
+	FPS          int           // Frame rate of the assembled video (default 24)
+}
+
+// Job is a single timelapse, recorded during one print
+type Job struct {
+	ProcessID int                       // ID of the print process this timelapse is of
+	Filename  string                    // Name of the file being printed
+	Dir       string                    // Directory the frames and video are written to
+	Frames    []string                  // Paths of the captured JPEG frames, in order
+	Video     string                    // Path of the assembled MJPEG AVI video, empty if none
+	Started   time.Time                 // When the print entered StepPrinting
+	Outcome   makerbot.PrintProcessStep // Step the print ended in, StepUnknown if it went away without finishing
+
+	capture chan struct{}
+	stop    chan struct{}
+}
+
+// Recorder captures a timelapse for every print. A job starts when a
+// print enters StepPrinting and finishes when it completes, fails or is
+// cancelled.
+type Recorder struct {
+	src      Source
+	opts     Options
+	job      *Job
+	last     int // last progress or estimated layer a frame was captured at
+	finishCb *func(*Job, error)
+	mux      sync.Mutex
+}
+
+// NewRecorder creates a Recorder that takes snapshots from `src`. It
+// returns an error if TriggerEstimatedLayer is used without Options.Layers.
+func NewRecorder(src Source, opts Options) (*Recorder, error) {
+	if opts.Trigger == TriggerEstimatedLayer && opts.Layers <= 0 {
+		return nil, errors.New("timelapse: TriggerEstimatedLayer needs Options.Layers")
+	}
+
+	if opts.Interval <= 0 {
+		opts.Interval = 10 * time.Second
+	}
+
+	if opts.ProgressStep <= 0 {
+		opts.ProgressStep = 1
+	}
+
+	if opts.FPS <= 0 {
+		opts.FPS = 24
+	}
+
+	return &Recorder{src: src, opts: opts}, nil
+}
+
+// Attach starts recording timelapses of prints on `c`
+func Attach(c *makerbot.Client, opts Options) (*Recorder, error) {
+	r, err := NewRecorder(c, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	c.HandleStateChange(r.StateHandler())
+	return r, nil
+}
+
+// HandleFinished calls `cb` when a job has finished and its video has
+// been assembled. `err` is non-nil if the video could not be assembled.
+func (r *Recorder) HandleFinished(cb func(job *Job, err error)) {
+	r.finishCb = &cb
+}
+
+// StateHandler returns a function suitable for Client.HandleStateChange.
+// Use Attach unless you are feeding states in from somewhere else.
+func (r *Recorder) StateHandler() func(old, new *makerbot.PrinterMetadata) {
+	return func(old, new *makerbot.PrinterMetadata) {
+		var proc *makerbot.PrinterProcess
+		if new != nil {
+			proc = new.CurrentProcess
+		}
+
+		r.mux.Lock()
+		defer r.mux.Unlock()
+
+		if r.job == nil {
+			if proc == nil || proc.Step != makerbot.StepPrinting || proc.Finished() {
+				return
+			}
+
+			r.start(proc)
+		}
+
+		if proc == nil || proc.ID != r.job.ProcessID {
+			r.finish(makerbot.StepUnknown)
+			return
+		}
+
+		if proc.Finished() {
+			r.finish(proc.Step)
+			return
+		}
+
+		if proc.Step != makerbot.StepPrinting || proc.Progress == nil {
+			return
+		}
+
+		var pos int
+		switch r.opts.Trigger {
+		case TriggerProgress:
+			pos = *proc.Progress / r.opts.ProgressStep
+		case TriggerEstimatedLayer:
+			pos = *proc.Progress * r.opts.Layers / 100
+		default:
+			return
+		}
+
+		if pos != r.last {
+			r.last = pos
+			r.trigger()
+		}
+	}
+}
+
+func (r *Recorder) start(proc *makerbot.PrinterProcess) {
+	started := time.Now()
+
+	job := &Job{
+		ProcessID: proc.ID,
+		Started:   started,
+		Dir:       filepath.Join(r.opts.Dir, fmt.Sprintf("%s_%d", started.Format("20060102-150405"), proc.ID)),
+		capture:   make(chan struct{}, 1),
+		stop:      make(chan struct{}),
+	}
+
+	if proc.Filename != nil {
+		job.Filename = *proc.Filename
+	}
+
+	r.job = job
+	r.last = -1
+
+	go r.run(job)
+
+	if r.opts.Trigger == TriggerInterval {
+		go func() {
+			ticker := time.NewTicker(r.opts.Interval)
+			defer ticker.Stop()
+
+			for {
+				select {
+				case <-ticker.C:
+					r.mux.Lock()
+					if r.job == job {
+						r.trigger()
+					}
+					r.mux.Unlock()
+				case <-job.stop:
+					return
+				}
+			}
+		}()
+
+		r.trigger()
+	}
+}
+
+// trigger asks the current job to capture a frame. Requests made
+// while a frame is being captured are coalesced.
+func (r *Recorder) trigger() {
+	select {
+	case r.job.capture <- struct{}{}:
+	default:
+	}
+}
+
+func (r *Recorder) finish(outcome makerbot.PrintProcessStep) {
+	r.job.Outcome = outcome
+	close(r.job.stop)
+	close(r.job.capture)
+	r.job = nil
+}
+
+func (r *Recorder) run(job *Job) {
+	err := os.MkdirAll(job.Dir, 0755)
+
+	for range job.capture {
+		if err != nil {
+			continue
+		}
+
+		err = r.capture(job)
+	}
+
+	if err == nil && len(job.Frames) > 0 {
+		video := filepath.Join(job.Dir, "timelapse.avi")
+
+		err = WriteAVIFile(video, job.Frames, r.opts.FPS)
+		if err == nil {
+			job.Video = video
+		}
+	}
+
+	if r.finishCb != nil {
+		(*r.finishCb)(job, err)
+	}
+}
+
+func (r *Recorder) capture(job *Job) error {
+	frame, err := r.src.GetCameraFrame()
+	if err != nil {
+		// Missing a frame is not fatal
+		return nil
+	}
+
+	data, err := frame.JPEG(makerbot.FrameEncodeOptions{})
+	if err != nil {
+		return nil
+	}
+
+	path := filepath.Join(job.Dir, fmt.Sprintf("frame_%05d.jpg", len(job.Frames)))
+
+	err = ioutil.WriteFile(path, data, 0644)
+	if err != nil {
+		return err
+	}
+
+	job.Frames = append(job.Frames, path)
+	return nil
+}
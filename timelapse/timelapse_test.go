@@ -0,0 +1,140 @@
+package timelapse_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"image"
+	"image/jpeg"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	makerbot "github.com/tjhorner/makerbot-rpc"
+	"github.com/tjhorner/makerbot-rpc/timelapse"
+)
+
+type fakeCamera struct{}
+
+func (fakeCamera) GetCameraFrame() (*makerbot.CameraFrame, error) {
+	var buf bytes.Buffer
+	jpeg.Encode(&buf, image.NewGray(image.Rect(0, 0, 16, 8)), nil)
+
+	return &makerbot.CameraFrame{
+		Data:     buf.Bytes(),
+		Metadata: &makerbot.CameraFrameMetadata{FileSize: uint32(buf.Len()), Width: 16, Height: 8, Format: makerbot.CameraFrameFormatJPEG},
+	}, nil
+}
+
+func state(t *testing.T, process string) *makerbot.PrinterMetadata {
+	var m makerbot.PrinterMetadata
+	err := json.Unmarshal([]byte(`{"current_process": `+process+`}`), &m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &m
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "timelapse")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return dir
+}
+
+func TestNewRecorderEstimatedLayers(t *testing.T) {
+	_, err := timelapse.NewRecorder(fakeCamera{}, timelapse.Options{Trigger: timelapse.TriggerEstimatedLayer})
+	if err == nil {
+		t.Error("TriggerEstimatedLayer without Layers wasn't refused")
+	}
+
+	_, err = timelapse.NewRecorder(fakeCamera{}, timelapse.Options{Trigger: timelapse.TriggerEstimatedLayer, Layers: 57})
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRecorder(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	rec, err := timelapse.NewRecorder(fakeCamera{}, timelapse.Options{Dir: dir, Trigger: timelapse.TriggerProgress, ProgressStep: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan *timelapse.Job, 1)
+	rec.HandleFinished(func(job *timelapse.Job, err error) {
+		if err != nil {
+			t.Error(err)
+		}
+		done <- job
+	})
+
+	handle := rec.StateHandler()
+	handle(nil, state(t, `{"id": 7, "filename": "box.makerbot", "step": "initializing"}`))
+
+	for p := 0; p <= 100; p += 5 {
+		handle(nil, state(t, `{"id": 7, "filename": "box.makerbot", "step": "printing", "progress": `+strconv.Itoa(p)+`}`))
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	handle(nil, state(t, `{"id": 7, "filename": "box.makerbot", "step": "completed", "complete": true}`))
+
+	var job *timelapse.Job
+	select {
+	case job = <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("job did not finish")
+	}
+
+	if job.ProcessID != 7 || job.Filename != "box.makerbot" || job.Outcome != makerbot.StepCompleted {
+		t.Errorf("job is wrong; got: %+v\n", job)
+	}
+
+	if len(job.Frames) == 0 || len(job.Frames) > 11 {
+		t.Errorf("wrong number of frames; wanted: 1-11, got: %d\n", len(job.Frames))
+	}
+
+	if job.Video != filepath.Join(job.Dir, "timelapse.avi") {
+		t.Errorf("video was not assembled; got: %q\n", job.Video)
+	}
+}
+
+func TestWriteAVI(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	var frames []string
+	for i := 0; i < 3; i++ {
+		frame, _ := fakeCamera{}.GetCameraFrame()
+		path := filepath.Join(dir, strconv.Itoa(i)+".jpg")
+		ioutil.WriteFile(path, frame.Data, 0644)
+		frames = append(frames, path)
+	}
+
+	var buf bytes.Buffer
+	err := timelapse.WriteAVI(&buf, frames, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := buf.Bytes()
+	if string(b[0:4]) != "RIFF" || string(b[8:12]) != "AVI " {
+		t.Fatalf("not an AVI file; got header %q\n", b[0:12])
+	}
+
+	if size := binary.LittleEndian.Uint32(b[4:8]); int(size)+8 != len(b) {
+		t.Errorf("RIFF size is wrong; wanted: %d, got: %d\n", len(b)-8, size)
+	}
+
+	if !bytes.Contains(b, []byte("idx1")) || bytes.Count(b, []byte("00dc")) != 6 {
+		t.Errorf("AVI is missing frames or its index")
+	}
+}
@@ -3,28 +3,24 @@ package makerbot
 import (
 	"bytes"
 	"encoding/json"
+	"time"
 )
 
 // Printer represents a connected printer
 type Printer struct {
-	MachineType        string `json:"machine_type"`         // The codename for this machine type
-	Vid                int    `json:"vid"`                  // Vendor ID of the printer
-	IP                 string `json:"ip"`                   // The local IP of this printer
-	Pid                int    `json:"pid"`                  // Product ID of the printer
-	APIVersion         string `json:"api_version"`          // API verison
-	Serial             string `json:"iserial"`              // Serial number of the printer
-	SSLPort            string `json:"ssl_port"`             // Port at which the HTTPS server can be accessed
-	MachineName        string `json:"machine_name"`         // User-defined printer name
-	MotorDriverVersion string `json:"motor_driver_version"` // Version number of the motor driver
-	BotType            string `json:"bot_type"`             // Codename for the bot type
-	Port               string `json:"port"`                 // JSON-RPC port (usually 9999)
-	FirmwareVersion    struct {
-		Major  int `json:"major"`
-		Minor  int `json:"minor"`
-		Bugfix int `json:"bugfix"`
-		Build  int `json:"build"`
-	} `json:"firmware_version"`
-	Metadata *PrinterMetadata `json:"-"`
+	MachineType        string           `json:"machine_type"`         // The codename for this machine type
+	Vid                int              `json:"vid"`                  // Vendor ID of the printer
+	IP                 string           `json:"ip"`                   // The local IP of this printer
+	Pid                int              `json:"pid"`                  // Product ID of the printer
+	APIVersion         string           `json:"api_version"`          // API verison
+	Serial             string           `json:"iserial"`              // Serial number of the printer
+	SSLPort            string           `json:"ssl_port"`             // Port at which the HTTPS server can be accessed
+	MachineName        string           `json:"machine_name"`         // User-defined printer name
+	MotorDriverVersion string           `json:"motor_driver_version"` // Version number of the motor driver
+	BotType            string           `json:"bot_type"`             // Codename for the bot type
+	Port               string           `json:"port"`                 // JSON-RPC port (usually 9999)
+	FirmwareVersion    FirmwareVersion  `json:"firmware_version"`     // Version of the firmware the printer is running
+	Metadata           *PrinterMetadata `json:"-"`
 }
 
 // PrinterMetadata is an object that the printer will send periodically
@@ -41,12 +37,7 @@ type PrinterMetadata struct {
 	IP                 string                `json:"ip"`
 	Toolheads          map[string][]Toolhead `json:"toolheads"`
 	MachineType        string                `json:"machine_type"`
-	FirmwareVersion    struct {
-		Major  int
-		Minor  int
-		Bugfix int
-		Build  int
-	} `json:"firmware_version"`
+	FirmwareVersion    FirmwareVersion       `json:"firmware_version"`
 }
 
 // PrinterProcess represents what the printer's current task is
@@ -274,3 +265,46 @@ type Toolhead struct {
 	ToolID             int     `json:"tool_id"`
 	CurrentTemperature float32 `json:"current_temperature"`
 }
+
+// Extruder returns the extruder Toolhead at `index`, or nil if the
+// printer did not report one. Use it within HandleStateChange to
+// watch a toolhead heat up or cool down.
+func (m *PrinterMetadata) Extruder(index int) *Toolhead {
+	if m == nil {
+		return nil
+	}
+
+	for i, t := range m.Toolheads["extruder"] {
+		if t.Index == index {
+			return &m.Toolheads["extruder"][i]
+		}
+	}
+
+	return nil
+}
+
+// Started returns the time at which the process was started, or the
+// zero time if the printer didn't report it.
+func (p *PrinterProcess) Started() time.Time {
+	if p.StartTime == nil {
+		return time.Time{}
+	}
+
+	return time.Time(*p.StartTime)
+}
+
+// Elapsed returns how long the process has been running for.
+func (p *PrinterProcess) Elapsed() time.Duration {
+	return time.Time(p.ElapsedTime).Sub(time.Unix(0, 0))
+}
+
+// Finished returns whether the process has ended, either because it
+// completed, failed or was cancelled.
+func (p *PrinterProcess) Finished() bool {
+	switch p.Step {
+	case StepCompleted, StepFailed, StepError:
+		return true
+	}
+
+	return p.Complete || p.Cancelled
+}
@@ -63,13 +63,18 @@ func unpackCameraFrameMetadata(packed []byte) CameraFrameMetadata {
 	}
 }
 
-func parseInfoFields(inf *[]string) *map[string]string {
-	var fields map[string]string
+func parseInfoFields(inf []string) map[string]string {
+	fields := make(map[string]string, len(inf))
 
-	for _, field := range *inf {
-		spl := strings.Split(field, "=")
-		fields[spl[0]] = fields[spl[1]]
+	for _, field := range inf {
+		spl := strings.SplitN(field, "=", 2)
+		if len(spl) < 2 {
+			fields[spl[0]] = ""
+			continue
+		}
+
+		fields[spl[0]] = spl[1]
 	}
 
-	return &fields
+	return fields
 }